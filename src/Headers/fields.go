@@ -0,0 +1,254 @@
+package headers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The three date formats from RFC 9110 section 5.6.7. Only TimeFormat
+// (IMF-fixdate) should be generated, the other two are accepted on input.
+const (
+	TimeFormat   = "Mon, 02 Jan 2006 15:04:05 GMT"
+	RFC850Format = "Monday, 02-Jan-06 15:04:05 GMT"
+	ANSICFormat  = "Mon Jan _2 15:04:05 2006"
+)
+
+var (
+	ErrBadContentLength = fmt.Errorf("Invalid Content-Length")
+	ErrBadMediaType     = fmt.Errorf("Invalid media type")
+	ErrBadDate          = fmt.Errorf("Invalid HTTP date")
+)
+
+// ContentLength returns the Content-Length value, -1 when there's none.
+// Repeated fields (or a list) are accepted only when every value agrees.
+func (h *Headers) ContentLength() (int64, error) {
+	values := h.Tokens("Content-Length")
+	if len(values) == 0 {
+		return -1, nil
+	}
+	for _, v := range values[1:] {
+		if v != values[0] {
+			return 0, fmt.Errorf("%w : conflicting values %q", ErrBadContentLength, h.Get("Content-Length"))
+		}
+	}
+
+	v := values[0]
+	if len(v) > 18 {
+		return 0, fmt.Errorf("%w : %q", ErrBadContentLength, v)
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] < '0' || v[i] > '9' {
+			return 0, fmt.Errorf("%w : %q", ErrBadContentLength, v)
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w : %q", ErrBadContentLength, v)
+	}
+	return n, nil
+}
+
+func (h *Headers) SetContentLength(n int64) {
+	h.Set("Content-Length", strconv.FormatInt(n, 10))
+}
+
+// ContentType returns the lowercased media type and its parameters, see
+// ParseMediaType. A missing Content-Type gives "" and no error.
+func (h *Headers) ContentType() (string, map[string]string, error) {
+	value := h.Get("Content-Type")
+	if value == "" {
+		return "", map[string]string{}, nil
+	}
+	return ParseMediaType(value)
+}
+
+func (h *Headers) SetContentType(mediaType string, params map[string]string) {
+	h.Set("Content-Type", FormatMediaType(mediaType, params))
+}
+
+// ParseMediaType splits a value like `text/html; charset="utf-8"` into the
+// lowercased type and its parameters, parameter names are lowercased too.
+// It also works for Content-Disposition style values like
+// `form-data; name="file"`.
+func ParseMediaType(value string) (string, map[string]string, error) {
+	mediaType, rest, _ := strings.Cut(value, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	params := map[string]string{}
+	if mediaType == "" {
+		return "", params, ErrBadMediaType
+	}
+	for _, part := range strings.SplitN(mediaType, "/", 2) {
+		if !IsValidToken(part) {
+			return "", params, fmt.Errorf("%w : %q", ErrBadMediaType, mediaType)
+		}
+	}
+
+	for {
+		rest = strings.TrimLeft(rest, " \t;")
+		if rest == "" {
+			return mediaType, params, nil
+		}
+		name, after, ok := strings.Cut(rest, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || !IsValidToken(name) {
+			return mediaType, params, fmt.Errorf("%w : bad parameter in %q", ErrBadMediaType, value)
+		}
+		after = strings.TrimLeft(after, " \t")
+
+		var paramValue string
+		if strings.HasPrefix(after, `"`) {
+			unquoted, n, err := unquote(after)
+			if err != nil {
+				return mediaType, params, fmt.Errorf("%w : %q", ErrBadMediaType, value)
+			}
+			paramValue = unquoted
+			rest = after[n:]
+		} else {
+			paramValue, rest, _ = strings.Cut(after, ";")
+			paramValue = strings.TrimSpace(paramValue)
+		}
+		params[name] = paramValue
+	}
+}
+
+// FormatMediaType is the inverse of ParseMediaType, parameters come out
+// sorted and quoted when they aren't plain tokens.
+func FormatMediaType(mediaType string, params map[string]string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(mediaType))
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteString("; ")
+		sb.WriteString(strings.ToLower(name))
+		sb.WriteByte('=')
+		value := params[name]
+		if IsValidToken(value) {
+			sb.WriteString(value)
+		} else {
+			sb.WriteString(quote(value))
+		}
+	}
+	return sb.String()
+}
+
+// unquote reads a quoted-string at the start of s, returning its content and
+// how many bytes of s it took
+func unquote(s string) (string, int, error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return sb.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", 0, ErrBadMediaType
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return "", 0, ErrBadMediaType
+}
+
+func quote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// ParseHTTPDate accepts all three formats HTTP dates come in.
+func ParseHTTPDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{TimeFormat, RFC850Format, ANSICFormat} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w : %q", ErrBadDate, value)
+}
+
+// FormatHTTPDate formats t as IMF-fixdate, the format to send.
+func FormatHTTPDate(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// Time parses key as an HTTP date, a missing field is the zero time.
+func (h *Headers) Time(key string) (time.Time, error) {
+	value := h.Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return ParseHTTPDate(value)
+}
+
+func (h *Headers) SetTime(key string, t time.Time) {
+	h.Set(key, FormatHTTPDate(t))
+}
+
+func (h *Headers) Date() (time.Time, error) {
+	return h.Time("Date")
+}
+
+func (h *Headers) SetDate(t time.Time) {
+	h.SetTime("Date", t)
+}
+
+func (h *Headers) LastModified() (time.Time, error) {
+	return h.Time("Last-Modified")
+}
+
+func (h *Headers) SetLastModified(t time.Time) {
+	h.SetTime("Last-Modified", t)
+}
+
+// Tokens splits every value of a list field like Connection or Vary on
+// commas, with empty elements dropped.
+func (h *Headers) Tokens(key string) []string {
+	var tokens []string
+	for _, value := range h.Values(key) {
+		for _, token := range strings.Split(value, ",") {
+			token = strings.Trim(token, " \t")
+			if token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// HasToken reports whether the list field key contains token, ignoring case.
+func (h *Headers) HasToken(key, token string) bool {
+	for _, t := range h.Tokens(key) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddToken appends token to the list field key unless it's already there.
+func (h *Headers) AddToken(key, token string) {
+	if h.HasToken(key, token) {
+		return
+	}
+	if existing := h.Get(key); existing != "" {
+		h.Set(key, existing+", "+token)
+		return
+	}
+	h.Set(key, token)
+}
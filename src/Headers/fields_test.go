@@ -0,0 +1,106 @@
+package headers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentLength(t *testing.T) {
+	headers := NewHeaders()
+	n, err := headers.ContentLength()
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), n)
+
+	headers.SetContentLength(1234)
+	assert.Equal(t, "1234", headers.Get("Content-Length"))
+	n, err = headers.ContentLength()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234), n)
+
+	// Test: Agreeing duplicates are one value
+	headers = NewHeaders()
+	headers.Add("Content-Length", "42")
+	headers.Add("Content-Length", "42, 42")
+	n, err = headers.ContentLength()
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+
+	for _, value := range []string{"-1", "+5", "1e3", "0x10", "12, 13", "99999999999999999999"} {
+		headers = NewHeaders()
+		headers.Set("Content-Length", value)
+		_, err = headers.ContentLength()
+		require.ErrorIs(t, err, ErrBadContentLength, value)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	headers := NewHeaders()
+	mediaType, params, err := headers.ContentType()
+	require.NoError(t, err)
+	assert.Equal(t, "", mediaType)
+	assert.Empty(t, params)
+
+	headers.Set("Content-Type", `Multipart/Form-Data; Boundary="a b\"c"; charset=UTF-8`)
+	mediaType, params, err = headers.ContentType()
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/form-data", mediaType)
+	assert.Equal(t, `a b"c`, params["boundary"])
+	assert.Equal(t, "UTF-8", params["charset"])
+
+	headers.SetContentType("text/html", map[string]string{"charset": "utf-8"})
+	assert.Equal(t, "text/html; charset=utf-8", headers.Get("Content-Type"))
+	assert.Equal(t, `text/plain; a=1; b="x y"`, FormatMediaType("text/plain", map[string]string{"b": "x y", "a": "1"}))
+
+	for _, value := range []string{"", "text /html", "text/html; =x", `text/html; charset="utf-8`} {
+		_, _, err = ParseMediaType(value)
+		require.ErrorIs(t, err, ErrBadMediaType, value)
+	}
+}
+
+func TestHTTPDate(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	for _, value := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseHTTPDate(value)
+		require.NoError(t, err, value)
+		assert.True(t, want.Equal(got), value)
+	}
+	_, err := ParseHTTPDate("yesterday")
+	require.ErrorIs(t, err, ErrBadDate)
+
+	headers := NewHeaders()
+	headers.SetDate(want.In(time.FixedZone("IST", 5*3600+1800)))
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", headers.Get("Date"))
+	got, err := headers.Date()
+	require.NoError(t, err)
+	assert.True(t, want.Equal(got))
+
+	got, err = headers.LastModified()
+	require.NoError(t, err)
+	assert.True(t, got.IsZero())
+	headers.SetLastModified(want)
+	got, err = headers.LastModified()
+	require.NoError(t, err)
+	assert.True(t, want.Equal(got))
+}
+
+func TestTokens(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Connection", "keep-alive, Upgrade")
+	headers.Add("Connection", " ,close")
+	assert.Equal(t, []string{"keep-alive", "Upgrade", "close"}, headers.Tokens("connection"))
+	assert.True(t, headers.HasToken("Connection", "upgrade"))
+	assert.False(t, headers.HasToken("Connection", "TE"))
+	assert.Empty(t, headers.Tokens("Vary"))
+
+	headers.AddToken("Vary", "Accept-Encoding")
+	headers.AddToken("Vary", "accept-encoding")
+	headers.AddToken("Vary", "Origin")
+	assert.Equal(t, "Accept-Encoding, Origin", headers.Get("Vary"))
+}
@@ -43,3 +43,115 @@ func TestHeadersParse(t *testing.T) {
 	assert.NotNil(t, headers)
 	assert.Equal(t, "localhost:42069, localhost:42068", headers.Get("HOST"))
 }
+
+func TestHeadersParseStrictness(t *testing.T) {
+	// Test: Repeated Content-Length values are all kept
+	headers := NewHeaders()
+	_, done, err := headers.Parse([]byte("Content-Length: 5\r\nContent-Length: 6\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, "5, 6", headers.Get("Content-Length"))
+
+	// Test: obs-fold and bare LF are errors unless lenient
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Folded: a\r\n b\r\n\r\n"))
+	require.ErrorIs(t, err, ObsFold)
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("Host: localhost\n\r\n"))
+	require.ErrorIs(t, err, BadLineEnding)
+
+	headers = NewHeaders()
+	n, done, err := headers.ParseLenient([]byte("X-Folded: a\r\n b\n\tc\nHost: localhost\n\n"))
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, 36, n)
+	assert.Equal(t, "a b c", headers.Get("X-Folded"))
+	assert.Equal(t, "localhost", headers.Get("Host"))
+
+	// Test: A folded line isn't committed before we know what follows it
+	headers = NewHeaders()
+	n, done, err = headers.ParseLenient([]byte("X-Folded: a\r\n"))
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, 0, n)
+
+	// Test: Bare CR is never a line ending
+	headers = NewHeaders()
+	_, _, err = headers.ParseLenient([]byte("Host: a\rb\r\n\r\n"))
+	require.ErrorIs(t, err, BadLineEnding)
+}
+
+func TestHeadersMultiValue(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Set-Cookie", "a=1; Path=/")
+	headers.Add("Content-Type", "text/plain")
+	headers.Add("set-cookie", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+	headers.Add("X-Trace", "one")
+
+	// Test: Values keeps every field intact, Get joins them
+	assert.Equal(t, []string{"a=1; Path=/", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT"}, headers.Values("SET-COOKIE"))
+	assert.Equal(t, "text/plain", headers.Get("content-type"))
+	assert.Nil(t, headers.Values("Missing"))
+	assert.True(t, headers.Has("x-trace"))
+	assert.Equal(t, 4, headers.Len())
+
+	// Test: Set replaces every value and stays where the first one was
+	headers.Set("SET-COOKIE", "c=3")
+	assert.Equal(t, []string{"c=3"}, headers.Values("Set-Cookie"))
+
+	lines := []string{}
+	headers.ForEach(func(key, value string) {
+		lines = append(lines, key+": "+value)
+	})
+	assert.Equal(t, []string{"SET-COOKIE: c=3", "Content-Type: text/plain", "X-Trace: one"}, lines)
+
+	// Test: Del removes every value
+	headers.Add("x-trace", "two")
+	headers.Del("X-TRACE")
+	assert.False(t, headers.Has("X-Trace"))
+	assert.Equal(t, 2, headers.Len())
+
+	// Test: Parsed fields keep their order and casing
+	headers = NewHeaders()
+	_, _, err := headers.Parse([]byte("Host: localhost\r\nX-B: 1\r\nx-a: 2\r\nX-B: 3\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Host: localhost\nX-B: 1\nx-a: 2\nX-B: 3\n", headers.Display())
+
+	// Test: The zero value works
+	var zero Headers
+	zero.Set("Connection", "close")
+	assert.Equal(t, "close", zero.Get("connection"))
+}
+
+func TestHeadersValidation(t *testing.T) {
+	// Test: Values with control characters are rejected while parsing
+	for _, line := range []string{
+		"X-Bad: a\x00b\r\n\r\n",
+		"X-Bad: a\x7fb\r\n\r\n",
+		"X-Bad: a\x0bb\r\n\r\n",
+	} {
+		headers := NewHeaders()
+		_, _, err := headers.Parse([]byte(line))
+		require.ErrorIs(t, err, InvalidValue, "%q", line)
+	}
+
+	// Test: Tabs and obs-text are fine
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("X-Ok: a\tb caf\xc3\xa9\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\tb caf\xc3\xa9", headers.Get("X-Ok"))
+	require.NoError(t, headers.Validate())
+
+	// Test: Validate catches what handlers put in
+	headers = NewHeaders()
+	headers.Set("Location", "/home\r\nSet-Cookie: admin=1")
+	require.ErrorIs(t, headers.Validate(), ErrInvalidField)
+
+	headers = NewHeaders()
+	headers.Set("X-Bad Name", "value")
+	require.ErrorIs(t, headers.Validate(), ErrInvalidField)
+
+	headers = NewHeaders()
+	headers.Set("X-Padded", " value")
+	require.ErrorIs(t, headers.Validate(), ErrInvalidField)
+}
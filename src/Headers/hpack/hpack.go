@@ -0,0 +1,275 @@
+// Package hpack implements HPACK (RFC 7541), the header compression of
+// HTTP/2, encoding from and decoding into headers.Headers.
+package hpack
+
+import (
+	"fmt"
+	"strings"
+
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+// DefaultTableSize is the dynamic table size both ends start with
+const DefaultTableSize = 4096
+
+// ErrDecode is a malformed header block, for HTTP/2 a COMPRESSION_ERROR
+var ErrDecode = fmt.Errorf("HPACK decoding error")
+
+// Encoder compresses header blocks for one connection, blocks have to be
+// sent in the order they're encoded.
+type Encoder struct {
+	// Sensitive names are sent as never-indexed literals so no
+	// intermediary stores them in its table
+	Sensitive map[string]bool
+	// DisableHuffman sends every string as is, by default Huffman coding
+	// is used unless it would be longer
+	DisableHuffman bool
+
+	table dynamicTable
+	// smallest size set since the last block and whether an update is due
+	minSize       uint32
+	pendingUpdate bool
+}
+
+func NewEncoder(maxTableSize uint32) *Encoder {
+	e := &Encoder{
+		Sensitive: map[string]bool{
+			"authorization":       true,
+			"proxy-authorization": true,
+		},
+	}
+	e.table.maxSize = DefaultTableSize
+	if maxTableSize != DefaultTableSize {
+		e.SetMaxTableSize(maxTableSize)
+	}
+	return e
+}
+
+// SetMaxTableSize changes the dynamic table size, n must not be more than
+// the peer's SETTINGS_HEADER_TABLE_SIZE. The change is signalled at the
+// start of the next block.
+func (e *Encoder) SetMaxTableSize(n uint32) {
+	if !e.pendingUpdate || n < e.minSize {
+		e.minSize = n
+	}
+	e.pendingUpdate = true
+	e.table.setMaxSize(n)
+}
+
+// Encode returns the header block for h. Names are lowercased as HTTP/2
+// requires, order is kept.
+func (e *Encoder) Encode(h *headers.Headers) []byte {
+	var block []byte
+	if e.pendingUpdate {
+		// a shrink followed by a grow has to be sent as both sizes,
+		// RFC 7541 section 4.2
+		if e.minSize < e.table.maxSize {
+			block = appendInteger(block, 0x20, 5, uint64(e.minSize))
+		}
+		block = appendInteger(block, 0x20, 5, uint64(e.table.maxSize))
+		e.pendingUpdate = false
+	}
+
+	h.ForEach(func(key, value string) {
+		block = e.appendField(block, entry{name: strings.ToLower(key), value: value})
+	})
+	return block
+}
+
+func (e *Encoder) appendField(block []byte, f entry) []byte {
+	index, exact := e.table.search(f)
+	if exact && !e.Sensitive[f.name] {
+		// 1xxxxxxx indexed field
+		return appendInteger(block, 0x80, 7, index)
+	}
+
+	switch {
+	case e.Sensitive[f.name]:
+		// 0001xxxx literal never indexed
+		block = appendInteger(block, 0x10, 4, index)
+	case f.size() > e.table.maxSize:
+		// 0000xxxx literal without indexing, it wouldn't fit anyway
+		block = appendInteger(block, 0x00, 4, index)
+	default:
+		// 01xxxxxx literal with incremental indexing
+		block = appendInteger(block, 0x40, 6, index)
+		e.table.add(f)
+	}
+	if index == 0 {
+		block = e.appendString(block, f.name)
+	}
+	return e.appendString(block, f.value)
+}
+
+func (e *Encoder) appendString(dst []byte, s string) []byte {
+	if n := huffmanEncodedLen(s); !e.DisableHuffman && n <= len(s) {
+		dst = appendInteger(dst, 0x80, 7, uint64(n))
+		return appendHuffman(dst, s)
+	}
+	dst = appendInteger(dst, 0x00, 7, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// Decoder decompresses the header blocks of one connection in order.
+type Decoder struct {
+	table dynamicTable
+	// maxAllowed is our SETTINGS_HEADER_TABLE_SIZE, the encoder may not
+	// pick a bigger table
+	maxAllowed uint32
+}
+
+func NewDecoder(maxTableSize uint32) *Decoder {
+	d := &Decoder{maxAllowed: maxTableSize}
+	d.table.maxSize = maxTableSize
+	return d
+}
+
+// SetMaxTableSize changes the largest table the encoder may use, call it
+// once the peer acknowledged the new setting.
+func (d *Decoder) SetMaxTableSize(n uint32) {
+	d.maxAllowed = n
+	if d.table.maxSize > n {
+		d.table.setMaxSize(n)
+	}
+}
+
+// Decode reads a complete header block. Any error leaves the table in an
+// unknown state, the connection has to be dropped.
+func (d *Decoder) Decode(block []byte) (*headers.Headers, error) {
+	h := headers.NewHeaders()
+	fieldSeen := false
+	for len(block) > 0 {
+		b := block[0]
+		var (
+			f   entry
+			err error
+		)
+		switch {
+		case b&0x80 != 0:
+			// indexed field
+			var index uint64
+			index, block, err = readInteger(block, 7)
+			if err != nil {
+				return nil, err
+			}
+			var ok bool
+			if f, ok = d.table.at(index); !ok {
+				return nil, fmt.Errorf("%w : bad index %d", ErrDecode, index)
+			}
+		case b&0xc0 == 0x40:
+			// literal with incremental indexing
+			if f, block, err = d.readLiteral(block, 6); err != nil {
+				return nil, err
+			}
+			d.table.add(f)
+		case b&0xe0 == 0x20:
+			// dynamic table size update, only allowed before the first field
+			if fieldSeen {
+				return nil, fmt.Errorf("%w : table size update after a field", ErrDecode)
+			}
+			var size uint64
+			if size, block, err = readInteger(block, 5); err != nil {
+				return nil, err
+			}
+			if size > uint64(d.maxAllowed) {
+				return nil, fmt.Errorf("%w : table size %d over the limit %d", ErrDecode, size, d.maxAllowed)
+			}
+			d.table.setMaxSize(uint32(size))
+			continue
+		default:
+			// literal without indexing (0000) or never indexed (0001)
+			if f, block, err = d.readLiteral(block, 4); err != nil {
+				return nil, err
+			}
+		}
+		fieldSeen = true
+		h.Add(f.name, f.value)
+	}
+	return h, nil
+}
+
+func (d *Decoder) readLiteral(block []byte, prefix uint) (entry, []byte, error) {
+	index, block, err := readInteger(block, prefix)
+	if err != nil {
+		return entry{}, nil, err
+	}
+	var f entry
+	if index == 0 {
+		if f.name, block, err = readString(block); err != nil {
+			return entry{}, nil, err
+		}
+	} else {
+		named, ok := d.table.at(index)
+		if !ok {
+			return entry{}, nil, fmt.Errorf("%w : bad index %d", ErrDecode, index)
+		}
+		f.name = named.name
+	}
+	if f.value, block, err = readString(block); err != nil {
+		return entry{}, nil, err
+	}
+	return f, block, nil
+}
+
+// appendInteger writes n with an prefix bits wide prefix, the bits above
+// it come from flags (RFC 7541 section 5.1)
+func appendInteger(dst []byte, flags byte, prefix uint, n uint64) []byte {
+	max := uint64(1)<<prefix - 1
+	if n < max {
+		return append(dst, flags|byte(n))
+	}
+	dst = append(dst, flags|byte(max))
+	n -= max
+	for n >= 0x80 {
+		dst = append(dst, byte(n&0x7f)|0x80)
+		n >>= 7
+	}
+	return append(dst, byte(n))
+}
+
+// maxIntegerBytes caps continuation bytes so a huge integer can't overflow
+const maxIntegerBytes = 5
+
+func readInteger(block []byte, prefix uint) (uint64, []byte, error) {
+	if len(block) == 0 {
+		return 0, nil, fmt.Errorf("%w : truncated integer", ErrDecode)
+	}
+	max := uint64(1)<<prefix - 1
+	n := uint64(block[0]) & max
+	block = block[1:]
+	if n < max {
+		return n, block, nil
+	}
+	for i := 0; i < maxIntegerBytes; i++ {
+		if i >= len(block) {
+			return 0, nil, fmt.Errorf("%w : truncated integer", ErrDecode)
+		}
+		b := block[i]
+		n += uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return n, block[i+1:], nil
+		}
+	}
+	return 0, nil, fmt.Errorf("%w : integer too large", ErrDecode)
+}
+
+func readString(block []byte) (string, []byte, error) {
+	if len(block) == 0 {
+		return "", nil, fmt.Errorf("%w : truncated string", ErrDecode)
+	}
+	huffman := block[0]&0x80 != 0
+	length, block, err := readInteger(block, 7)
+	if err != nil {
+		return "", nil, err
+	}
+	if length > uint64(len(block)) {
+		return "", nil, fmt.Errorf("%w : truncated string", ErrDecode)
+	}
+	data := block[:length]
+	block = block[length:]
+	if !huffman {
+		return string(data), block, nil
+	}
+	s, err := huffmanDecode(data)
+	return s, block, err
+}
@@ -0,0 +1,255 @@
+package hpack
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+// block parses the spaced hex dumps of RFC 7541 Appendix C
+func block(t *testing.T, dump string) []byte {
+	b, err := hex.DecodeString(strings.Join(strings.Fields(dump), ""))
+	require.NoError(t, err)
+	return b
+}
+
+func fields(pairs ...string) *headers.Headers {
+	h := headers.NewHeaders()
+	for i := 0; i < len(pairs); i += 2 {
+		h.Add(pairs[i], pairs[i+1])
+	}
+	return h
+}
+
+func pairs(h *headers.Headers) []string {
+	var out []string
+	h.ForEach(func(key, value string) {
+		out = append(out, key, value)
+	})
+	return out
+}
+
+type example struct {
+	fields    []string
+	dump      string
+	tableSize uint32
+}
+
+// runExamples encodes and decodes a sequence of blocks on one connection,
+// checking the bytes and the dynamic table size after each
+func runExamples(t *testing.T, maxTableSize uint32, huffman bool, examples []example) {
+	enc := NewEncoder(DefaultTableSize)
+	enc.DisableHuffman = !huffman
+	dec := NewDecoder(DefaultTableSize)
+	if maxTableSize != DefaultTableSize {
+		// set on both sides without a size update, as the examples assume
+		enc.table.setMaxSize(maxTableSize)
+		dec.table.setMaxSize(maxTableSize)
+	}
+
+	for i, ex := range examples {
+		want := block(t, ex.dump)
+		assert.Equal(t, want, enc.Encode(fields(ex.fields...)), "encode %d", i)
+		assert.Equal(t, ex.tableSize, enc.table.size, "encoder table %d", i)
+
+		h, err := dec.Decode(want)
+		require.NoError(t, err, "decode %d", i)
+		assert.Equal(t, ex.fields, pairs(h), "decode %d", i)
+		assert.Equal(t, ex.tableSize, dec.table.size, "decoder table %d", i)
+	}
+}
+
+func TestLiteralExamples(t *testing.T) {
+	// C.2.1 literal with indexing
+	dec := NewDecoder(DefaultTableSize)
+	h, err := dec.Decode(block(t, "400a 6375 7374 6f6d 2d6b 6579 0d63 7573 746f 6d2d 6865 6164 6572"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"custom-key", "custom-header"}, pairs(h))
+	assert.Equal(t, uint32(55), dec.table.size)
+
+	// C.2.2 literal without indexing
+	dec = NewDecoder(DefaultTableSize)
+	h, err = dec.Decode(block(t, "040c 2f73 616d 706c 652f 7061 7468"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{":path", "/sample/path"}, pairs(h))
+	assert.Equal(t, uint32(0), dec.table.size)
+
+	// C.2.3 literal never indexed
+	dec = NewDecoder(DefaultTableSize)
+	h, err = dec.Decode(block(t, "1008 7061 7373 776f 7264 0673 6563 7265 74"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"password", "secret"}, pairs(h))
+	assert.Equal(t, uint32(0), dec.table.size)
+
+	enc := NewEncoder(DefaultTableSize)
+	enc.DisableHuffman = true
+	enc.Sensitive["password"] = true
+	assert.Equal(t, block(t, "1008 7061 7373 776f 7264 0673 6563 7265 74"), enc.Encode(fields("password", "secret")))
+	assert.Equal(t, uint32(0), enc.table.size)
+
+	// C.2.4 indexed field
+	dec = NewDecoder(DefaultTableSize)
+	h, err = dec.Decode([]byte{0x82})
+	require.NoError(t, err)
+	assert.Equal(t, []string{":method", "GET"}, pairs(h))
+}
+
+var requestFields = [][]string{
+	{":method", "GET", ":scheme", "http", ":path", "/", ":authority", "www.example.com"},
+	{":method", "GET", ":scheme", "http", ":path", "/", ":authority", "www.example.com", "cache-control", "no-cache"},
+	{":method", "GET", ":scheme", "https", ":path", "/index.html", ":authority", "www.example.com", "custom-key", "custom-value"},
+}
+
+func TestRequestExamples(t *testing.T) {
+	// C.3 without Huffman coding
+	runExamples(t, DefaultTableSize, false, []example{
+		{requestFields[0], "8286 8441 0f77 7777 2e65 7861 6d70 6c65 2e63 6f6d", 57},
+		{requestFields[1], "8286 84be 5808 6e6f 2d63 6163 6865", 110},
+		{requestFields[2], "8287 85bf 400a 6375 7374 6f6d 2d6b 6579 0c63 7573 746f 6d2d 7661 6c75 65", 164},
+	})
+
+	// C.4 with Huffman coding
+	runExamples(t, DefaultTableSize, true, []example{
+		{requestFields[0], "8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff", 57},
+		{requestFields[1], "8286 84be 5886 a8eb 1064 9cbf", 110},
+		{requestFields[2], "8287 85bf 4088 25a8 49e9 5ba9 7d7f 8925 a849 e95b b8e8 b4bf", 164},
+	})
+}
+
+var responseFields = [][]string{
+	{":status", "302", "cache-control", "private", "date", "Mon, 21 Oct 2013 20:13:21 GMT", "location", "https://www.example.com"},
+	{":status", "307", "cache-control", "private", "date", "Mon, 21 Oct 2013 20:13:21 GMT", "location", "https://www.example.com"},
+	{":status", "200", "cache-control", "private", "date", "Mon, 21 Oct 2013 20:13:22 GMT", "location", "https://www.example.com",
+		"content-encoding", "gzip", "set-cookie", "foo=ASDJKHQKBZXOQWEOPIUAXQWEOIU; max-age=3600; version=1"},
+}
+
+func TestResponseExamples(t *testing.T) {
+	// C.5 without Huffman coding, a 256 byte table forces evictions
+	runExamples(t, 256, false, []example{
+		{responseFields[0], `4803 3330 3258 0770 7269 7661 7465 611d 4d6f 6e2c 2032 3120 4f63 7420 3230 3133
+			2032 303a 3133 3a32 3120 474d 546e 1768 7474 7073 3a2f 2f77 7777 2e65 7861 6d70
+			6c65 2e63 6f6d`, 222},
+		{responseFields[1], "4803 3330 37c1 c0bf", 222},
+		{responseFields[2], `88c1 611d 4d6f 6e2c 2032 3120 4f63 7420 3230 3133 2032 303a 3133 3a32 3220 474d
+			54c0 5a04 677a 6970 7738 666f 6f3d 4153 444a 4b48 514b 425a 584f 5157 454f 5049
+			5541 5851 5745 4f49 553b 206d 6178 2d61 6765 3d33 3630 303b 2076 6572 7369 6f6e
+			3d31`, 215},
+	})
+
+	// C.6 with Huffman coding
+	runExamples(t, 256, true, []example{
+		{responseFields[0], `4882 6402 5885 aec3 771a 4b61 96d0 7abe 9410 54d4 44a8 2005 9504 0b81 66e0 82a6
+			2d1b ff6e 919d 29ad 1718 63c7 8f0b 97c8 e9ae 82ae 43d3`, 222},
+		{responseFields[1], "4883 640e ffc1 c0bf", 222},
+		{responseFields[2], `88c1 6196 d07a be94 1054 d444 a820 0595 040b 8166 e084 a62d 1bff c05a 839b d9ab
+			77ad 94e7 821d d7f2 e6c7 b335 dfdf cd5b 3960 d5af 2708 7f36 72c1 ab27 0fb5 291f
+			9587 3160 65c0 03ed 4ee5 b106 3d50 07`, 215},
+	})
+}
+
+func TestIntegers(t *testing.T) {
+	// C.1 examples
+	assert.Equal(t, []byte{0x0a}, appendInteger(nil, 0, 5, 10))
+	assert.Equal(t, []byte{0x1f, 0x9a, 0x0a}, appendInteger(nil, 0, 5, 1337))
+	assert.Equal(t, []byte{0x2a}, appendInteger(nil, 0, 8, 42))
+
+	n, rest, err := readInteger([]byte{0x1f, 0x9a, 0x0a, 0xff}, 5)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1337), n)
+	assert.Equal(t, []byte{0xff}, rest)
+
+	_, _, err = readInteger([]byte{0x1f, 0x9a}, 5)
+	require.ErrorIs(t, err, ErrDecode)
+	_, _, err = readInteger([]byte{0x1f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 5)
+	require.ErrorIs(t, err, ErrDecode)
+}
+
+func TestHuffman(t *testing.T) {
+	for _, s := range []string{"", "www.example.com", "no-cache", "\x00\xff binary \x7f\x80", "custom-value"} {
+		got, err := huffmanDecode(appendHuffman(nil, s))
+		require.NoError(t, err, "%q", s)
+		assert.Equal(t, s, got)
+		assert.Equal(t, huffmanEncodedLen(s), len(appendHuffman(nil, s)))
+	}
+
+	// padding longer than 7 bits
+	_, err := huffmanDecode([]byte{0xff})
+	require.ErrorIs(t, err, ErrDecode)
+	// padding that isn't all ones: "a" is 00011, padded with zeros
+	_, err = huffmanDecode([]byte{0x18})
+	require.ErrorIs(t, err, ErrDecode)
+	// EOS inside the string
+	_, err = huffmanDecode([]byte{0xff, 0xff, 0xff, 0xff})
+	require.ErrorIs(t, err, ErrDecode)
+}
+
+func TestTableSizeUpdates(t *testing.T) {
+	enc := NewEncoder(DefaultTableSize)
+	dec := NewDecoder(DefaultTableSize)
+	h := fields("custom-key", "custom-header")
+	_, err := dec.Decode(enc.Encode(h))
+	require.NoError(t, err)
+	require.Len(t, dec.table.entries, 1)
+
+	// shrink to 0 then grow again, both sizes have to be sent
+	enc.SetMaxTableSize(0)
+	enc.SetMaxTableSize(1024)
+	b := enc.Encode(h)
+	assert.Equal(t, []byte{0x20, 0x3f, 0xe1, 0x07}, b[:4])
+	got, err := dec.Decode(b)
+	require.NoError(t, err)
+	assert.Equal(t, pairs(h), pairs(got))
+	assert.Equal(t, uint32(1024), dec.table.maxSize)
+	// the old entry went with the shrink, the new one came in after
+	assert.Len(t, dec.table.entries, 1)
+
+	// a size over what we allowed
+	dec.SetMaxTableSize(100)
+	assert.Equal(t, uint32(100), dec.table.maxSize)
+	_, err = dec.Decode(appendInteger(nil, 0x20, 5, 200))
+	require.ErrorIs(t, err, ErrDecode)
+
+	// an update after a field
+	dec = NewDecoder(DefaultTableSize)
+	_, err = dec.Decode([]byte{0x82, 0x20})
+	require.ErrorIs(t, err, ErrDecode)
+}
+
+func TestEncoder(t *testing.T) {
+	enc := NewEncoder(DefaultTableSize)
+	dec := NewDecoder(DefaultTableSize)
+	h := fields("Content-Type", "text/html", "Authorization", "Bearer secret", "X-Big", strings.Repeat("x", 5000), "Set-Cookie", "a=1", "Set-Cookie", "b=2")
+	b := enc.Encode(h)
+	got, err := dec.Decode(b)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"content-type", "text/html",
+		"authorization", "Bearer secret",
+		"x-big", strings.Repeat("x", 5000),
+		"set-cookie", "a=1",
+		"set-cookie", "b=2",
+	}, pairs(got))
+	// authorization is never indexed and x-big doesn't fit
+	assert.Equal(t, 3, len(enc.table.entries))
+	assert.Equal(t, enc.table.entries, dec.table.entries)
+
+	// the second time round everything indexable is a single byte
+	b = enc.Encode(fields("content-type", "text/html", "set-cookie", "b=2"))
+	assert.Len(t, b, 2)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, dump := range []string{
+		"80",        // index 0
+		"ff00",      // index past the tables
+		"400a 6375", // truncated name
+		"0485 ff",   // truncated Huffman value
+	} {
+		_, err := NewDecoder(DefaultTableSize).Decode(block(t, dump))
+		require.ErrorIs(t, err, ErrDecode, dump)
+	}
+}
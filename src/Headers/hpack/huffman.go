@@ -0,0 +1,94 @@
+package hpack
+
+import (
+	"fmt"
+	"sync"
+)
+
+// huffmanNode is a node of the decoding tree, a leaf when it has no
+// children
+type huffmanNode struct {
+	children [2]*huffmanNode
+	symbol   byte
+}
+
+var (
+	huffmanRoot     *huffmanNode
+	huffmanRootOnce sync.Once
+)
+
+func buildHuffmanTree() {
+	huffmanRoot = &huffmanNode{}
+	for sym, code := range huffmanCodes {
+		node := huffmanRoot
+		for i := int(huffmanCodeLens[sym]) - 1; i >= 0; i-- {
+			bit := (code >> i) & 1
+			if node.children[bit] == nil {
+				node.children[bit] = &huffmanNode{}
+			}
+			node = node.children[bit]
+		}
+		node.symbol = byte(sym)
+	}
+}
+
+// huffmanEncodedLen is how many bytes s takes Huffman coded
+func huffmanEncodedLen(s string) int {
+	bits := 0
+	for i := 0; i < len(s); i++ {
+		bits += int(huffmanCodeLens[s[i]])
+	}
+	return (bits + 7) / 8
+}
+
+// appendHuffman appends s Huffman coded, padded with the high bits of EOS
+func appendHuffman(dst []byte, s string) []byte {
+	var acc uint64
+	var bits uint
+	for i := 0; i < len(s); i++ {
+		acc = acc<<huffmanCodeLens[s[i]] | uint64(huffmanCodes[s[i]])
+		bits += uint(huffmanCodeLens[s[i]])
+		for bits >= 8 {
+			bits -= 8
+			dst = append(dst, byte(acc>>bits))
+		}
+	}
+	if bits > 0 {
+		pad := 8 - bits
+		dst = append(dst, byte(acc<<pad|(1<<pad-1)))
+	}
+	return dst
+}
+
+// huffmanDecode decodes data. The padding has to be shorter than a byte and
+// all ones, EOS itself must not appear (RFC 7541 section 5.2).
+func huffmanDecode(data []byte) (string, error) {
+	huffmanRootOnce.Do(buildHuffmanTree)
+	out := make([]byte, 0, len(data)*8/5)
+	node := huffmanRoot
+	// bits read since the last symbol and whether they were all ones
+	pending := 0
+	allOnes := true
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			bit := (b >> i) & 1
+			node = node.children[bit]
+			if node == nil {
+				// only EOS is missing from the tree
+				return "", fmt.Errorf("%w : EOS in Huffman string", ErrDecode)
+			}
+			pending++
+			allOnes = allOnes && bit == 1
+			if node.children[0] == nil && node.children[1] == nil {
+				out = append(out, node.symbol)
+				node = huffmanRoot
+				pending = 0
+				allOnes = true
+			}
+		}
+	}
+	if pending > 7 || !allOnes {
+		return "", fmt.Errorf("%w : bad Huffman padding", ErrDecode)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,151 @@
+package hpack
+
+// entryOverhead is added to every entry's size, RFC 7541 section 4.1
+const entryOverhead = 32
+
+type entry struct {
+	name  string
+	value string
+}
+
+func (e entry) size() uint32 {
+	return uint32(len(e.name)+len(e.value)) + entryOverhead
+}
+
+// staticTable is RFC 7541 Appendix A, index 1 is staticTable[0]
+var staticTable = [...]entry{
+	{":authority", ""},
+	{":method", "GET"},
+	{":method", "POST"},
+	{":path", "/"},
+	{":path", "/index.html"},
+	{":scheme", "http"},
+	{":scheme", "https"},
+	{":status", "200"},
+	{":status", "204"},
+	{":status", "206"},
+	{":status", "304"},
+	{":status", "400"},
+	{":status", "404"},
+	{":status", "500"},
+	{"accept-charset", ""},
+	{"accept-encoding", "gzip, deflate"},
+	{"accept-language", ""},
+	{"accept-ranges", ""},
+	{"accept", ""},
+	{"access-control-allow-origin", ""},
+	{"age", ""},
+	{"allow", ""},
+	{"authorization", ""},
+	{"cache-control", ""},
+	{"content-disposition", ""},
+	{"content-encoding", ""},
+	{"content-language", ""},
+	{"content-length", ""},
+	{"content-location", ""},
+	{"content-range", ""},
+	{"content-type", ""},
+	{"cookie", ""},
+	{"date", ""},
+	{"etag", ""},
+	{"expect", ""},
+	{"expires", ""},
+	{"from", ""},
+	{"host", ""},
+	{"if-match", ""},
+	{"if-modified-since", ""},
+	{"if-none-match", ""},
+	{"if-range", ""},
+	{"if-unmodified-since", ""},
+	{"last-modified", ""},
+	{"link", ""},
+	{"location", ""},
+	{"max-forwards", ""},
+	{"proxy-authenticate", ""},
+	{"proxy-authorization", ""},
+	{"range", ""},
+	{"referer", ""},
+	{"refresh", ""},
+	{"retry-after", ""},
+	{"server", ""},
+	{"set-cookie", ""},
+	{"strict-transport-security", ""},
+	{"transfer-encoding", ""},
+	{"user-agent", ""},
+	{"vary", ""},
+	{"via", ""},
+	{"www-authenticate", ""},
+}
+
+// dynamicTable holds the newest entry first, so entries[0] is index 62
+type dynamicTable struct {
+	entries []entry
+	size    uint32
+	maxSize uint32
+}
+
+func (t *dynamicTable) add(e entry) {
+	t.entries = append([]entry{e}, t.entries...)
+	t.size += e.size()
+	// an entry bigger than the whole table just empties it
+	t.evict()
+}
+
+func (t *dynamicTable) setMaxSize(n uint32) {
+	t.maxSize = n
+	t.evict()
+}
+
+func (t *dynamicTable) evict() {
+	for t.size > t.maxSize && len(t.entries) > 0 {
+		last := len(t.entries) - 1
+		t.size -= t.entries[last].size()
+		t.entries[last] = entry{}
+		t.entries = t.entries[:last]
+	}
+}
+
+// at returns the entry for an index across both tables, ok is false for
+// index 0 and anything past the end
+func (t *dynamicTable) at(index uint64) (entry, bool) {
+	if index == 0 {
+		return entry{}, false
+	}
+	if index <= uint64(len(staticTable)) {
+		return staticTable[index-1], true
+	}
+	index -= uint64(len(staticTable)) + 1
+	if index >= uint64(len(t.entries)) {
+		return entry{}, false
+	}
+	return t.entries[index], true
+}
+
+// search looks for e in the static table and then the dynamic one.
+// index is 0 when not even the name is there, exact tells whether the
+// value matched too.
+func (t *dynamicTable) search(e entry) (index uint64, exact bool) {
+	for i, s := range staticTable {
+		if s.name != e.name {
+			continue
+		}
+		if s.value == e.value {
+			return uint64(i + 1), true
+		}
+		if index == 0 {
+			index = uint64(i + 1)
+		}
+	}
+	for i, d := range t.entries {
+		if d.name != e.name {
+			continue
+		}
+		if d.value == e.value {
+			return uint64(len(staticTable) + i + 1), true
+		}
+		if index == 0 {
+			index = uint64(len(staticTable) + i + 1)
+		}
+	}
+	return index, false
+}
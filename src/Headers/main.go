@@ -6,24 +6,58 @@ import (
 	"strings"
 )
 
+// Headers keeps field lines in the order they were added. Names keep the
+// casing they were added with and are looked up case-insensitively, a name
+// can appear any number of times. The zero value is ready to use.
 type Headers struct {
-	headers map[string]string
+	fields []field
 }
 
-var rn = []byte("\r\n")
+type field struct {
+	name  string
+	value string
+}
 
 func NewHeaders() *Headers {
-	return &Headers{
-		headers: map[string]string{},
-	}
+	return &Headers{}
+}
+
+// ParseError is a header parsing failure along with the status code a
+// server should answer it with.
+type ParseError struct {
+	StatusCode int
+	Reason     string
+}
+
+func (e *ParseError) Error() string {
+	return e.Reason
 }
 
 var (
-	MalformedHeader = fmt.Errorf("Error Malformed Headers")
+	MalformedHeader  = &ParseError{StatusCode: 400, Reason: "Error Malformed Headers"}
+	InvalidFieldName = &ParseError{StatusCode: 400, Reason: "Invalid header field name"}
+	ObsFold          = &ParseError{StatusCode: 400, Reason: "Obsolete line folding"}
+	BadLineEnding    = &ParseError{StatusCode: 400, Reason: "Bare CR or LF in header section"}
+	InvalidValue     = &ParseError{StatusCode: 400, Reason: "Invalid header field value"}
+
+	// ErrInvalidField is returned by Validate, writers refuse to send such
+	// a field since CR or LF in it would split the message
+	ErrInvalidField = fmt.Errorf("Invalid header field")
 )
 
-func (h *Headers) Delete(key string) {
-	delete(h.headers, key)
+// Del removes every field named key
+func (h *Headers) Del(key string) {
+	kept := h.fields[:0]
+	for _, f := range h.fields {
+		if !strings.EqualFold(f.name, key) {
+			kept = append(kept, f)
+		}
+	}
+	// clear the tail so dropped strings can be collected
+	for i := len(kept); i < len(h.fields); i++ {
+		h.fields[i] = field{}
+	}
+	h.fields = kept
 }
 
 func IsValidToken(str string) bool {
@@ -48,6 +82,36 @@ func IsValidToken(str string) bool {
 	return true
 }
 
+// IsValidFieldValue checks value against field-value from RFC 9110: visible
+// characters, SP, HTAB and obs-text. CR, LF, NUL and other controls aren't
+// allowed, and neither is whitespace at either end.
+func IsValidFieldValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if (ch < ' ' && ch != '\t') || ch == 0x7f {
+			return false
+		}
+	}
+	if len(value) > 0 && (isFoldWhitespace(value[0]) || isFoldWhitespace(value[len(value)-1])) {
+		return false
+	}
+	return true
+}
+
+// Validate checks every field name and value, the error names the first
+// bad field.
+func (h *Headers) Validate() error {
+	for _, f := range h.fields {
+		if !IsValidToken(f.name) {
+			return fmt.Errorf("%w : bad name %q", ErrInvalidField, f.name)
+		}
+		if !IsValidFieldValue(f.value) {
+			return fmt.Errorf("%w : bad value for %s %q", ErrInvalidField, f.name, f.value)
+		}
+	}
+	return nil
+}
+
 func parseHeaders(fieldLine []byte) (string, string, error) {
 
 	isValid := strings.Contains(string(fieldLine), ":")
@@ -62,11 +126,12 @@ func parseHeaders(fieldLine []byte) (string, string, error) {
 		return "", "", MalformedHeader
 	}
 	key := parts[0]
-	value := bytes.TrimSpace(parts[1])
+	// only SP and HTAB count as OWS around the value
+	value := bytes.Trim(parts[1], " \t")
 	// fmt.Printf("THIS IS AFTER TRIMMING - %s\n", value)
 	if !IsValidToken(string(key)) {
 		// fmt.Println("The tokens aren't valid")
-		return "", "", MalformedHeader
+		return "", "", InvalidFieldName
 	}
 
 	// if bytes.HasSuffix(key, []byte(" ")) {
@@ -75,53 +140,121 @@ func parseHeaders(fieldLine []byte) (string, string, error) {
 	// 	return "", "", MalformedHeader
 	// }
 	// fmt.Printf("Key is - %s\nValue is %s\n", string(key), string(value))
+	if !IsValidFieldValue(string(value)) {
+		return "", "", InvalidValue
+	}
 
 	return string(key), string(value), nil
 }
 
+// Get returns all values of key joined with ", ", the combined form RFC 9110
+// allows for repeated fields. Don't use it for Set-Cookie, use Values.
 func (h *Headers) Get(key string) string {
-	val := h.headers[strings.ToLower(key)]
+	val := strings.Join(h.Values(key), ", ")
 	if len(bytes.TrimSpace([]byte(val))) == 0 {
 		return ""
 	}
-	return h.headers[strings.ToLower(key)]
+	return val
+}
+
+// Values returns every value of key in the order they were added
+func (h *Headers) Values(key string) []string {
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			values = append(values, f.value)
+		}
+	}
+	return values
+}
+
+func (h *Headers) Has(key string) bool {
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return true
+		}
+	}
+	return false
 }
+
+// Add appends a field line, keeping any existing ones with the same name
+func (h *Headers) Add(key, value string) {
+	h.fields = append(h.fields, field{name: key, value: value})
+}
+
+// Set replaces every value of key with value. The field keeps the position
+// of its first occurrence so output order doesn't jump around.
 func (h *Headers) Set(key, value string) {
-	name := strings.ToLower(key)
-	if name == "content-length" || name == "content-type" {
-		h.headers[name] = value
-	} else {
-		if v, ok := h.headers[name]; ok {
-			h.headers[name] = fmt.Sprintf("%s, %s", v, value)
-		} else {
-			h.headers[name] = value
+	for i, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			h.fields[i] = field{name: key, value: value}
+			kept := h.fields[:i+1]
+			for _, rest := range h.fields[i+1:] {
+				if !strings.EqualFold(rest.name, key) {
+					kept = append(kept, rest)
+				}
+			}
+			h.fields = kept
+			return
 		}
 	}
+	h.Add(key, value)
 }
 
 func (h *Headers) Display() string {
-	for k, v := range h.headers {
-		return fmt.Sprintf("%s: %s\n", k, v)
-	}
-	return ""
+	var sb strings.Builder
+	h.ForEach(func(key, value string) {
+		fmt.Fprintf(&sb, "%s: %s\n", key, value)
+	})
+	return sb.String()
 }
 
+// Parse reads field lines up to the empty line that ends the section. It is
+// strict: lines must end in CRLF and obs-fold continuation lines are rejected.
 func (h *Headers) Parse(data []byte) (int, bool, error) {
+	return h.parse(data, false)
+}
+
+// ParseLenient is Parse but accepts a bare LF as line ending and unfolds
+// obs-fold continuation lines into a single SP, as RFC 9112 allows.
+func (h *Headers) ParseLenient(data []byte) (int, bool, error) {
+	return h.parse(data, true)
+}
+
+func (h *Headers) parse(data []byte, lenient bool) (int, bool, error) {
 	read := 0
 	done := false
 	for {
-		idx := bytes.Index(data[read:], rn)
-		if idx == -1 {
+		line, n, err := NextLine(data[read:], lenient)
+		if err != nil {
+			return 0, false, err
+		}
+		if n == 0 {
 			done = false
 			break
 		}
-		lineEnd := read + idx
-		line := data[read:lineEnd]
 		if len(line) == 0 {
 			done = true
-			read += len(rn)
+			read += n
 			break
 		}
+		if isFoldWhitespace(line[0]) {
+			// a continuation line without a field to continue, or we're strict
+			return 0, false, ObsFold
+		}
+
+		if lenient {
+			complete := true
+			line, n, complete, err = unfold(data[read:], line, n)
+			if err != nil {
+				return 0, false, err
+			}
+			if !complete {
+				// can't tell yet whether the next line continues this one
+				break
+			}
+		}
+
 		key, value, err := parseHeaders(line)
 		key = string(bytes.TrimSpace([]byte(key)))
 		if err != nil {
@@ -129,15 +262,74 @@ func (h *Headers) Parse(data []byte) (int, bool, error) {
 			return 0, false, err
 		}
 
-		h.Set(key, value)
-		read = lineEnd + len(rn)
+		h.Add(key, value)
+		read += n
 
 	}
 	return read, done, nil
 }
 
+// unfold joins continuation lines (starting with SP or HTAB) onto line,
+// complete is false while the byte after the last line hasn't arrived.
+func unfold(data, line []byte, n int) ([]byte, int, bool, error) {
+	for {
+		if n >= len(data) {
+			return nil, 0, false, nil
+		}
+		if !isFoldWhitespace(data[n]) {
+			return line, n, true, nil
+		}
+		next, m, err := NextLine(data[n:], true)
+		if err != nil || m == 0 {
+			return nil, 0, false, err
+		}
+		// copy so the caller's buffer isn't written over
+		joined := make([]byte, 0, len(line)+1+len(next))
+		joined = append(joined, bytes.TrimRight(line, " \t")...)
+		joined = append(joined, ' ')
+		joined = append(joined, bytes.TrimLeft(next, " \t")...)
+		line = joined
+		n += m
+	}
+}
+
+func isFoldWhitespace(ch byte) bool {
+	return ch == ' ' || ch == '\t'
+}
+
+// NextLine finds the first line in data. n is how many bytes it used up
+// including the line ending, 0 when the line isn't complete yet. A bare LF
+// is only accepted as line ending when allowBareLF is set, a CR anywhere
+// but right before the LF is always an error.
+func NextLine(data []byte, allowBareLF bool) (line []byte, n int, err error) {
+	idx := bytes.IndexByte(data, '\n')
+	if idx == -1 {
+		if cr := bytes.IndexByte(data, '\r'); cr != -1 && cr != len(data)-1 {
+			return nil, 0, BadLineEnding
+		}
+		return nil, 0, nil
+	}
+	line = data[:idx]
+	if idx > 0 && data[idx-1] == '\r' {
+		line = data[:idx-1]
+	} else if !allowBareLF {
+		return nil, 0, BadLineEnding
+	}
+	if bytes.IndexByte(line, '\r') != -1 {
+		return nil, 0, BadLineEnding
+	}
+	return line, idx + 1, nil
+}
+
+// ForEach calls f for every field line in order, with the name as it was
+// added
 func (h *Headers) ForEach(f func(key, value string)) {
-	for k, v := range h.headers {
-		f(k, v)
+	for _, fl := range h.fields {
+		f(fl.name, fl.value)
 	}
 }
+
+// Len is the number of field lines
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
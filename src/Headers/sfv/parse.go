@@ -0,0 +1,357 @@
+package sfv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parser follows the parsing algorithms of RFC 8941 section 4.2, pos is the
+// next byte of s to look at
+type parser struct {
+	s   string
+	pos int
+}
+
+func ParseItem(value string) (Item, error) {
+	p := newParser(value)
+	item, err := p.item()
+	if err != nil {
+		return Item{}, err
+	}
+	return item, p.end()
+}
+
+func ParseList(value string) (List, error) {
+	p := newParser(value)
+	list := List{}
+	for !p.eof() {
+		member, err := p.itemOrInnerList()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, member)
+		if err := p.nextMember(); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func ParseDictionary(value string) (Dictionary, error) {
+	p := newParser(value)
+	dict := Dictionary{}
+	for !p.eof() {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var member Member
+		if !p.eof() && p.s[p.pos] == '=' {
+			p.pos++
+			member, err = p.itemOrInnerList()
+		} else {
+			// a bare key is a true Boolean
+			var params Params
+			params, err = p.params()
+			member = Item{Value: true, Params: params}
+		}
+		if err != nil {
+			return nil, err
+		}
+		dict.Set(key, member)
+		if err := p.nextMember(); err != nil {
+			return nil, err
+		}
+	}
+	return dict, nil
+}
+
+func newParser(value string) *parser {
+	return &parser{s: strings.Trim(value, " ")}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) fail(what string) error {
+	return fmt.Errorf("%w : %s at %d in %q", ErrParse, what, p.pos, p.s)
+}
+
+// end makes sure nothing is left over after the top level value
+func (p *parser) end() error {
+	if !p.eof() {
+		return p.fail("trailing characters")
+	}
+	return nil
+}
+
+func (p *parser) skipSP() {
+	for !p.eof() && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *parser) skipOWS() {
+	for !p.eof() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// nextMember steps over the comma between list or dictionary members, a
+// trailing comma is an error
+func (p *parser) nextMember() error {
+	p.skipOWS()
+	if p.eof() {
+		return nil
+	}
+	if p.s[p.pos] != ',' {
+		return p.fail("expected ','")
+	}
+	p.pos++
+	p.skipOWS()
+	if p.eof() {
+		return p.fail("trailing ','")
+	}
+	return nil
+}
+
+func (p *parser) itemOrInnerList() (Member, error) {
+	if !p.eof() && p.s[p.pos] == '(' {
+		return p.innerList()
+	}
+	return p.item()
+}
+
+func (p *parser) innerList() (InnerList, error) {
+	p.pos++ // (
+	list := InnerList{Items: []Item{}}
+	for !p.eof() {
+		p.skipSP()
+		if p.eof() {
+			break
+		}
+		if p.s[p.pos] == ')' {
+			p.pos++
+			params, err := p.params()
+			if err != nil {
+				return InnerList{}, err
+			}
+			list.Params = params
+			return list, nil
+		}
+		item, err := p.item()
+		if err != nil {
+			return InnerList{}, err
+		}
+		list.Items = append(list.Items, item)
+		if p.eof() || (p.s[p.pos] != ' ' && p.s[p.pos] != ')') {
+			return InnerList{}, p.fail("expected ' ' or ')' in inner list")
+		}
+	}
+	return InnerList{}, p.fail("unterminated inner list")
+}
+
+func (p *parser) item() (Item, error) {
+	value, err := p.bareItem()
+	if err != nil {
+		return Item{}, err
+	}
+	params, err := p.params()
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{Value: value, Params: params}, nil
+}
+
+func (p *parser) params() (Params, error) {
+	var params Params
+	for !p.eof() && p.s[p.pos] == ';' {
+		p.pos++
+		p.skipSP()
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var value any = true
+		if !p.eof() && p.s[p.pos] == '=' {
+			p.pos++
+			if value, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		params.Set(key, value)
+	}
+	return params, nil
+}
+
+func (p *parser) key() (string, error) {
+	if p.eof() || !(isLCAlpha(p.s[p.pos]) || p.s[p.pos] == '*') {
+		return "", p.fail("expected key")
+	}
+	start := p.pos
+	for !p.eof() && isKeyChar(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *parser) bareItem() (any, error) {
+	if p.eof() {
+		return nil, p.fail("expected item")
+	}
+	switch ch := p.s[p.pos]; {
+	case ch == '-' || isDigit(ch):
+		return p.number()
+	case ch == '"':
+		return p.string()
+	case ch == '*' || isAlpha(ch):
+		return p.token(), nil
+	case ch == ':':
+		return p.byteSequence()
+	case ch == '?':
+		return p.boolean()
+	}
+	return nil, p.fail("unexpected character")
+}
+
+func (p *parser) number() (any, error) {
+	start := p.pos
+	if p.s[p.pos] == '-' {
+		p.pos++
+	}
+	if p.eof() || !isDigit(p.s[p.pos]) {
+		return nil, p.fail("expected digit")
+	}
+	digitsStart := p.pos
+	decimal := false
+	for !p.eof() {
+		ch := p.s[p.pos]
+		if isDigit(ch) {
+			p.pos++
+		} else if !decimal && ch == '.' {
+			if p.pos-digitsStart > 12 {
+				return nil, p.fail("decimal integer part too long")
+			}
+			decimal = true
+			p.pos++
+		} else {
+			break
+		}
+		if n := p.pos - digitsStart; (!decimal && n > 15) || (decimal && n > 16) {
+			return nil, p.fail("number too long")
+		}
+	}
+
+	num := p.s[start:p.pos]
+	if !decimal {
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, p.fail("bad integer")
+		}
+		return n, nil
+	}
+	dot := strings.IndexByte(num, '.')
+	if frac := len(num) - dot - 1; frac < 1 || frac > 3 {
+		return nil, p.fail("decimal needs 1 to 3 fractional digits")
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return nil, p.fail("bad decimal")
+	}
+	return f, nil
+}
+
+func (p *parser) string() (string, error) {
+	p.pos++ // "
+	var sb strings.Builder
+	for !p.eof() {
+		ch := p.s[p.pos]
+		p.pos++
+		switch {
+		case ch == '\\':
+			if p.eof() || (p.s[p.pos] != '"' && p.s[p.pos] != '\\') {
+				return "", p.fail("bad escape in string")
+			}
+			sb.WriteByte(p.s[p.pos])
+			p.pos++
+		case ch == '"':
+			return sb.String(), nil
+		case ch < 0x20 || ch > 0x7e:
+			return "", p.fail("non printable character in string")
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return "", p.fail("unterminated string")
+}
+
+func (p *parser) token() Token {
+	start := p.pos
+	p.pos++
+	for !p.eof() && isTokenChar(p.s[p.pos]) {
+		p.pos++
+	}
+	return Token(p.s[start:p.pos])
+}
+
+func (p *parser) byteSequence() ([]byte, error) {
+	p.pos++ // :
+	end := strings.IndexByte(p.s[p.pos:], ':')
+	if end == -1 {
+		return nil, p.fail("unterminated byte sequence")
+	}
+	encoded := p.s[p.pos : p.pos+end]
+	for i := 0; i < len(encoded); i++ {
+		ch := encoded[i]
+		if !isAlpha(ch) && !isDigit(ch) && ch != '+' && ch != '/' && ch != '=' {
+			return nil, p.fail("bad base64 character")
+		}
+	}
+	// padding is optional on input
+	decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, p.fail("bad base64")
+	}
+	p.pos += end + 1
+	return decoded, nil
+}
+
+func (p *parser) boolean() (bool, error) {
+	p.pos++ // ?
+	if p.eof() {
+		return false, p.fail("expected boolean")
+	}
+	ch := p.s[p.pos]
+	p.pos++
+	switch ch {
+	case '1':
+		return true, nil
+	case '0':
+		return false, nil
+	}
+	return false, p.fail("expected ?0 or ?1")
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isLCAlpha(ch byte) bool {
+	return ch >= 'a' && ch <= 'z'
+}
+
+func isAlpha(ch byte) bool {
+	return isLCAlpha(ch) || (ch >= 'A' && ch <= 'Z')
+}
+
+func isKeyChar(ch byte) bool {
+	return isLCAlpha(ch) || isDigit(ch) || ch == '_' || ch == '-' || ch == '.' || ch == '*'
+}
+
+// isTokenChar is tchar plus ':' and '/'
+func isTokenChar(ch byte) bool {
+	return isAlpha(ch) || isDigit(ch) || strings.IndexByte("!#$%&'*+-.^_`|~:/", ch) != -1
+}
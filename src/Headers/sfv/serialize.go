@@ -0,0 +1,197 @@
+package sfv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const maxInteger = 999_999_999_999_999
+
+// MarshalItem serializes item as described in RFC 8941 section 4.1
+func MarshalItem(item Item) (string, error) {
+	var sb strings.Builder
+	if err := writeItem(&sb, item); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func MarshalList(list List) (string, error) {
+	var sb strings.Builder
+	for i, member := range list {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		if err := writeMember(&sb, member); err != nil {
+			return "", err
+		}
+	}
+	return sb.String(), nil
+}
+
+func MarshalDictionary(dict Dictionary) (string, error) {
+	var sb strings.Builder
+	for i, m := range dict {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		if err := writeKey(&sb, m.Key); err != nil {
+			return "", err
+		}
+		// true Booleans are written as the bare key
+		if item, ok := m.Value.(Item); ok && item.Value == true {
+			if err := writeParams(&sb, item.Params); err != nil {
+				return "", err
+			}
+			continue
+		}
+		sb.WriteByte('=')
+		if err := writeMember(&sb, m.Value); err != nil {
+			return "", err
+		}
+	}
+	return sb.String(), nil
+}
+
+func writeMember(sb *strings.Builder, member Member) error {
+	switch m := member.(type) {
+	case Item:
+		return writeItem(sb, m)
+	case InnerList:
+		return writeInnerList(sb, m)
+	}
+	return fmt.Errorf("%w : unknown member %T", ErrSerialize, member)
+}
+
+func writeInnerList(sb *strings.Builder, list InnerList) error {
+	sb.WriteByte('(')
+	for i, item := range list.Items {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		if err := writeItem(sb, item); err != nil {
+			return err
+		}
+	}
+	sb.WriteByte(')')
+	return writeParams(sb, list.Params)
+}
+
+func writeItem(sb *strings.Builder, item Item) error {
+	if err := writeBareItem(sb, item.Value); err != nil {
+		return err
+	}
+	return writeParams(sb, item.Params)
+}
+
+func writeParams(sb *strings.Builder, params Params) error {
+	for _, param := range params {
+		sb.WriteByte(';')
+		if err := writeKey(sb, param.Key); err != nil {
+			return err
+		}
+		if param.Value == true {
+			continue
+		}
+		sb.WriteByte('=')
+		if err := writeBareItem(sb, param.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeKey(sb *strings.Builder, key string) error {
+	if key == "" || !(isLCAlpha(key[0]) || key[0] == '*') {
+		return fmt.Errorf("%w : bad key %q", ErrSerialize, key)
+	}
+	for i := 0; i < len(key); i++ {
+		if !isKeyChar(key[i]) {
+			return fmt.Errorf("%w : bad key %q", ErrSerialize, key)
+		}
+	}
+	sb.WriteString(key)
+	return nil
+}
+
+func writeBareItem(sb *strings.Builder, value any) error {
+	switch v := value.(type) {
+	case int:
+		return writeInteger(sb, int64(v))
+	case int64:
+		return writeInteger(sb, v)
+	case float64:
+		return writeDecimal(sb, v)
+	case string:
+		return writeString(sb, v)
+	case Token:
+		return writeToken(sb, v)
+	case []byte:
+		sb.WriteByte(':')
+		sb.WriteString(base64.StdEncoding.EncodeToString(v))
+		sb.WriteByte(':')
+		return nil
+	case bool:
+		if v {
+			sb.WriteString("?1")
+		} else {
+			sb.WriteString("?0")
+		}
+		return nil
+	}
+	return fmt.Errorf("%w : unsupported value %T", ErrSerialize, value)
+}
+
+func writeInteger(sb *strings.Builder, n int64) error {
+	if n > maxInteger || n < -maxInteger {
+		return fmt.Errorf("%w : integer %d out of range", ErrSerialize, n)
+	}
+	sb.WriteString(strconv.FormatInt(n, 10))
+	return nil
+}
+
+// writeDecimal rounds to three fractional digits, ties to even
+func writeDecimal(sb *strings.Builder, f float64) error {
+	rounded := math.RoundToEven(f*1000) / 1000
+	if math.IsNaN(rounded) || math.Abs(rounded) >= 1e12 {
+		return fmt.Errorf("%w : decimal %v out of range", ErrSerialize, f)
+	}
+	s := strconv.FormatFloat(rounded, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	sb.WriteString(s)
+	return nil
+}
+
+func writeString(sb *strings.Builder, s string) error {
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch < 0x20 || ch > 0x7e {
+			return fmt.Errorf("%w : non printable character in string %q", ErrSerialize, s)
+		}
+		if ch == '"' || ch == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(ch)
+	}
+	sb.WriteByte('"')
+	return nil
+}
+
+func writeToken(sb *strings.Builder, t Token) error {
+	if t == "" || !(isAlpha(t[0]) || t[0] == '*') {
+		return fmt.Errorf("%w : bad token %q", ErrSerialize, t)
+	}
+	for i := 1; i < len(t); i++ {
+		if !isTokenChar(t[i]) {
+			return fmt.Errorf("%w : bad token %q", ErrSerialize, t)
+		}
+	}
+	sb.WriteString(string(t))
+	return nil
+}
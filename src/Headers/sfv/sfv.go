@@ -0,0 +1,166 @@
+// Package sfv reads and writes Structured Field Values (RFC 8941), the typed
+// syntax used by fields like Priority, Cache-Status or Signature-Input.
+//
+// Bare item values are one of:
+//
+//	int64   Integer
+//	float64 Decimal
+//	string  String
+//	Token   Token
+//	[]byte  Byte Sequence
+//	bool    Boolean
+package sfv
+
+import (
+	"fmt"
+
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+// Token is a bare token like `gzip` or `*`, as opposed to a quoted String
+type Token string
+
+var (
+	ErrParse     = fmt.Errorf("Invalid structured field")
+	ErrSerialize = fmt.Errorf("Can't serialize structured field")
+	// ErrNoField is returned by GetItem when the field isn't there, an
+	// Item can't be empty the way a List or Dictionary can
+	ErrNoField = fmt.Errorf("Structured field missing")
+)
+
+// Param is one `;key=value` parameter
+type Param struct {
+	Key   string
+	Value any
+}
+
+// Params keep the order they were parsed or added in
+type Params []Param
+
+// Get returns the value of key, a parameter without a value is true
+func (p Params) Get(key string) (any, bool) {
+	for _, param := range p {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set overwrites key in place or appends it
+func (p *Params) Set(key string, value any) {
+	for i := range *p {
+		if (*p)[i].Key == key {
+			(*p)[i].Value = value
+			return
+		}
+	}
+	*p = append(*p, Param{Key: key, Value: value})
+}
+
+// Member is a List or Dictionary member, either an Item or an InnerList
+type Member interface {
+	member()
+}
+
+type Item struct {
+	Value  any
+	Params Params
+}
+
+// InnerList is a parenthesized list of items, `(a b);p=1`
+type InnerList struct {
+	Items  []Item
+	Params Params
+}
+
+func (Item) member()      {}
+func (InnerList) member() {}
+
+type List []Member
+
+type DictMember struct {
+	Key   string
+	Value Member
+}
+
+// Dictionary keeps its members in order, a repeated key replaces the
+// earlier value but keeps its position
+type Dictionary []DictMember
+
+func (d Dictionary) Get(key string) (Member, bool) {
+	for _, m := range d {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (d *Dictionary) Set(key string, value Member) {
+	for i := range *d {
+		if (*d)[i].Key == key {
+			(*d)[i].Value = value
+			return
+		}
+	}
+	*d = append(*d, DictMember{Key: key, Value: value})
+}
+
+// GetItem parses field key of h as an Item. Repeated field lines are
+// combined first, which for an Item is always an error.
+func GetItem(h *headers.Headers, key string) (Item, error) {
+	if !h.Has(key) {
+		return Item{}, fmt.Errorf("%w : %s", ErrNoField, key)
+	}
+	return ParseItem(h.Get(key))
+}
+
+// GetList parses field key of h as a List, a missing field is an empty List
+func GetList(h *headers.Headers, key string) (List, error) {
+	return ParseList(h.Get(key))
+}
+
+// GetDictionary parses field key of h as a Dictionary, a missing field is
+// an empty Dictionary
+func GetDictionary(h *headers.Headers, key string) (Dictionary, error) {
+	return ParseDictionary(h.Get(key))
+}
+
+func SetItem(h *headers.Headers, key string, item Item) error {
+	value, err := MarshalItem(item)
+	if err != nil {
+		return err
+	}
+	h.Set(key, value)
+	return nil
+}
+
+// SetList sets key to list, an empty list removes the field since it can't
+// be sent empty
+func SetList(h *headers.Headers, key string, list List) error {
+	value, err := MarshalList(list)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		h.Del(key)
+		return nil
+	}
+	h.Set(key, value)
+	return nil
+}
+
+// SetDictionary sets key to dict, an empty dictionary removes the field
+func SetDictionary(h *headers.Headers, key string, dict Dictionary) error {
+	value, err := MarshalDictionary(dict)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		h.Del(key)
+		return nil
+	}
+	h.Set(key, value)
+	return nil
+}
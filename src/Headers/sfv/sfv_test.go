@@ -0,0 +1,205 @@
+package sfv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+func TestParseItem(t *testing.T) {
+	cases := map[string]any{
+		"42":                int64(42),
+		"-999999999999999":  int64(-999999999999999),
+		"4.5":               4.5,
+		"-0.001":            -0.001,
+		`"hello \"world\""`: `hello "world"`,
+		"foo123/456":        Token("foo123/456"),
+		"*":                 Token("*"),
+		":cHJldGVuZCB0aGlzIGlzIGJpbmFyeSBjb250ZW50Lg==:": []byte("pretend this is binary content."),
+		":aGk:": []byte("hi"),
+		"?1":    true,
+		"?0":    false,
+	}
+	for value, want := range cases {
+		item, err := ParseItem(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, item.Value, value)
+	}
+
+	// Test: Parameters keep order, bare keys are true
+	item, err := ParseItem(`text/html;q=0.5;charset="utf-8";fresh;q=1.0`)
+	require.NoError(t, err)
+	assert.Equal(t, Token("text/html"), item.Value)
+	assert.Equal(t, Params{{"q", 1.0}, {"charset", "utf-8"}, {"fresh", true}}, item.Params)
+	fresh, ok := item.Params.Get("fresh")
+	assert.True(t, ok)
+	assert.Equal(t, true, fresh)
+
+	for _, value := range []string{
+		"",
+		"1234567890123456",
+		"1234567890123.0",
+		"1.2345",
+		"1.",
+		"-",
+		`"unterminated`,
+		`"bad \x escape"`,
+		"\"tab\tinside\"",
+		":not base64!:",
+		"?2",
+		"a b",
+		"1;Key=2",
+		"1; =2",
+		"é",
+	} {
+		_, err := ParseItem(value)
+		require.ErrorIs(t, err, ErrParse, "%q", value)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	list, err := ParseList(`sugar, tea, ("foo" "bar");lvl=5, rum;q=0.5`)
+	require.NoError(t, err)
+	require.Len(t, list, 4)
+	assert.Equal(t, Item{Value: Token("sugar")}, list[0])
+	assert.Equal(t, InnerList{
+		Items:  []Item{{Value: "foo"}, {Value: "bar"}},
+		Params: Params{{"lvl", int64(5)}},
+	}, list[2])
+	assert.Equal(t, Item{Value: Token("rum"), Params: Params{{"q", 0.5}}}, list[3])
+
+	list, err = ParseList("(), (  1   2  )")
+	require.NoError(t, err)
+	assert.Equal(t, List{InnerList{Items: []Item{}}, InnerList{Items: []Item{{Value: int64(1)}, {Value: int64(2)}}}}, list)
+
+	list, err = ParseList("")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	for _, value := range []string{"a,", "a,,b", "a b", "(1 2", "(1,2)", "(1)(2)"} {
+		_, err := ParseList(value)
+		require.ErrorIs(t, err, ErrParse, "%q", value)
+	}
+}
+
+func TestParseDictionary(t *testing.T) {
+	dict, err := ParseDictionary(`u=2, i, a=(1 2), b=?0;x, u=5`)
+	require.NoError(t, err)
+	require.Len(t, dict, 4)
+	// a repeated key keeps the first position with the last value
+	assert.Equal(t, "u", dict[0].Key)
+	u, ok := dict.Get("u")
+	require.True(t, ok)
+	assert.Equal(t, Item{Value: int64(5)}, u)
+	i, _ := dict.Get("i")
+	assert.Equal(t, Item{Value: true}, i)
+	b, _ := dict.Get("b")
+	assert.Equal(t, Item{Value: false, Params: Params{{"x", true}}}, b)
+	_, ok = dict.Get("missing")
+	assert.False(t, ok)
+
+	for _, value := range []string{"A=1", "a=1,", "a=", "1=a", "a=1 b=2"} {
+		_, err := ParseDictionary(value)
+		require.ErrorIs(t, err, ErrParse, "%q", value)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	s, err := MarshalItem(Item{Value: 1.0})
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", s)
+
+	// rounding is to three digits, ties go to even
+	s, err = MarshalItem(Item{Value: 0.0025})
+	require.NoError(t, err)
+	assert.Equal(t, "0.002", s)
+
+	s, err = MarshalItem(Item{Value: []byte("hi"), Params: Params{{"a", true}, {"b", Token("x")}, {"c", `say "hi"`}}})
+	require.NoError(t, err)
+	assert.Equal(t, `:aGk=:;a;b=x;c="say \"hi\""`, s)
+
+	s, err = MarshalList(List{
+		Item{Value: Token("sugar")},
+		InnerList{Items: []Item{{Value: int64(1)}, {Value: false}}, Params: Params{{"lvl", 5}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "sugar, (1 ?0);lvl=5", s)
+
+	s, err = MarshalDictionary(Dictionary{
+		{"u", Item{Value: int64(2)}},
+		{"i", Item{Value: true, Params: Params{{"x", int64(1)}}}},
+		{"b", Item{Value: false}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "u=2, i;x=1, b=?0", s)
+
+	for _, item := range []Item{
+		{Value: int64(1_000_000_000_000_000)},
+		{Value: 1e12},
+		{Value: "caf\xc3\xa9"},
+		{Value: Token("1abc")},
+		{Value: Token("a b")},
+		{Value: uint8(1)},
+		{Value: int64(1), Params: Params{{"Upper", true}}},
+	} {
+		_, err := MarshalItem(item)
+		require.ErrorIs(t, err, ErrSerialize, "%v", item)
+	}
+
+	// Test: Round trip
+	for _, value := range []string{
+		`sugar, tea, ("foo" "bar");lvl=5, rum;q=0.5`,
+		`a=?0, b, c;foo=bar, d=:AAE=:`,
+	} {
+		list, err := ParseList(value)
+		if err == nil {
+			s, err = MarshalList(list)
+			require.NoError(t, err)
+			assert.Equal(t, value, s)
+			continue
+		}
+		dict, err := ParseDictionary(value)
+		require.NoError(t, err)
+		s, err = MarshalDictionary(dict)
+		require.NoError(t, err)
+		assert.Equal(t, value, s)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	h := headers.NewHeaders()
+	_, _, err := h.Parse([]byte("Priority: u=1\r\nCache-Status: origin; hit\r\nCache-Status: cdn; fwd=miss\r\nX-Count: 5\r\n\r\n"))
+	require.NoError(t, err)
+
+	dict, err := GetDictionary(h, "priority")
+	require.NoError(t, err)
+	urgency, _ := dict.Get("u")
+	assert.Equal(t, Item{Value: int64(1)}, urgency)
+
+	// the two Cache-Status lines combine into one list
+	list, err := GetList(h, "Cache-Status")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, Item{Value: Token("cdn"), Params: Params{{"fwd", Token("miss")}}}, list[1])
+
+	item, err := GetItem(h, "X-Count")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), item.Value)
+	_, err = GetItem(h, "X-Missing")
+	require.ErrorIs(t, err, ErrNoField)
+	list, err = GetList(h, "X-Missing")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	require.NoError(t, SetItem(h, "X-Count", Item{Value: int64(6)}))
+	assert.Equal(t, "6", h.Get("X-Count"))
+	require.NoError(t, SetDictionary(h, "Priority", Dictionary{{"u", Item{Value: int64(3)}}, {"i", Item{Value: true}}}))
+	assert.Equal(t, "u=3, i", h.Get("Priority"))
+	require.NoError(t, SetList(h, "Cache-Status", List{}))
+	assert.False(t, h.Has("Cache-Status"))
+
+	require.ErrorIs(t, SetItem(h, "X-Count", Item{Value: "\r\n"}), ErrSerialize)
+	assert.Equal(t, "6", h.Get("X-Count"))
+}
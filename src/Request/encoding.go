@@ -0,0 +1,151 @@
+package request
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	ErrUnsupportedContentEncoding = fmt.Errorf("Unsupported content coding")
+	ErrMalformedContentEncoding   = fmt.Errorf("Malformed content coding")
+)
+
+// SupportedContentEncodings are the request body codings that get undone,
+// in the form a 415 response advertises them with Accept-Encoding
+const SupportedContentEncodings = "gzip, deflate"
+
+// maxContentCodings bounds how many codings can be stacked on one body,
+// nobody compresses three times on purpose
+const maxContentCodings = 3
+
+// decodeContent puts the decompressors for the body's Content-Encoding in
+// front of BodyReader. Content-Encoding and Content-Length are removed
+// since they describe the bytes on the wire, ContentEncoding keeps the
+// codings that were undone. A request without content has nothing to
+// decode and is left as it is.
+func (r *Request) decodeContent() error {
+	if r.state == StateDone && len(r.body) == 0 {
+		return nil
+	}
+	var codings []string
+	for _, coding := range r.Headers.Tokens("Content-Encoding") {
+		coding = strings.ToLower(coding)
+		switch coding {
+		case "identity":
+			continue
+		case "gzip", "x-gzip", "deflate":
+		default:
+			return fmt.Errorf("%w : %s", ErrUnsupportedContentEncoding, coding)
+		}
+		codings = append(codings, coding)
+	}
+	if len(codings) == 0 {
+		return nil
+	}
+	if len(codings) > maxContentCodings {
+		return fmt.Errorf("%w : %d codings stacked", ErrUnsupportedContentEncoding, len(codings))
+	}
+
+	r.ContentEncoding = codings
+	r.Headers.Del("Content-Encoding")
+	r.Headers.Del("Content-Length")
+	r.BodyReader = &decodingReader{
+		src:     r.BodyReader,
+		codings: codings,
+		max:     r.limits.MaxDecodedBody,
+	}
+	return nil
+}
+
+// decodingReader undoes the content codings lazily, the decompressors read
+// their headers on the first Read so a client waiting for 100 Continue
+// isn't stuck before the handler asks for the body.
+type decodingReader struct {
+	src     io.ReadCloser
+	codings []string
+	max     int64
+
+	r    io.Reader
+	read int64
+	err  error
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.r == nil {
+		if d.err = d.start(); d.err != nil {
+			return 0, d.err
+		}
+	}
+	n, err := d.r.Read(p)
+	d.read += int64(n)
+	if d.max > 0 && d.read > d.max {
+		d.err = wrapError(fmt.Errorf("%w : more than %d bytes once decoded", ErrBodyTooLarge, d.max))
+		return 0, d.err
+	}
+	if err != nil && err != io.EOF {
+		err = d.wrap(err)
+		d.err = err
+	}
+	return n, err
+}
+
+// start stacks the decompressors, the last coding listed was applied last
+// so it comes off first
+func (d *decodingReader) start() error {
+	var r io.Reader = d.src
+	for i := len(d.codings) - 1; i >= 0; i-- {
+		var err error
+		switch d.codings[i] {
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(r)
+		case "deflate":
+			r, err = newDeflateReader(r)
+		}
+		if err != nil {
+			return d.wrap(err)
+		}
+	}
+	d.r = r
+	return nil
+}
+
+// wrap marks decompression errors as a bad request, errors from reading the
+// body itself already say what went wrong
+func (d *decodingReader) wrap(err error) error {
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		return err
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("truncated : %w", err)
+	}
+	return wrapError(fmt.Errorf("%w : %w", ErrMalformedContentEncoding, err))
+}
+
+func (d *decodingReader) Close() error {
+	return d.src.Close()
+}
+
+// newDeflateReader reads "deflate", which is the zlib format (RFC 9110
+// section 8.4.1.2). Some clients send a bare deflate stream instead, the
+// zlib header tells them apart.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
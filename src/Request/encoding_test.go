@@ -0,0 +1,132 @@
+package request
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func zlibbed(b []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func rawDeflated(b []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func postWith(encoding string, body []byte) string {
+	return fmt.Sprintf("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\n"+
+		"Content-Encoding: %s\r\nContent-Length: %d\r\n\r\n%s", encoding, len(body), body)
+}
+
+func TestContentEncoding(t *testing.T) {
+	payload := []byte(`{"message":"` + strings.Repeat("squeeze me ", 50) + `"}`)
+
+	for name, tc := range map[string]struct {
+		encoding string
+		body     []byte
+		codings  []string
+	}{
+		"gzip":          {"gzip", gzipped(payload), []string{"gzip"}},
+		"x-gzip":        {"x-gzip", gzipped(payload), []string{"x-gzip"}},
+		"deflate":       {"deflate", zlibbed(payload), []string{"deflate"}},
+		"raw deflate":   {"deflate", rawDeflated(payload), []string{"deflate"}},
+		"stacked":       {"deflate, gzip", gzipped(zlibbed(payload)), []string{"deflate", "gzip"}},
+		"identity only": {"identity", payload, nil},
+	} {
+		r, err := RequestFromReader(strings.NewReader(postWith(tc.encoding, tc.body)))
+		require.NoError(t, err, name)
+		assert.Equal(t, string(payload), string(r.Body), name)
+		assert.Equal(t, tc.codings, r.ContentEncoding, name)
+		if tc.codings != nil {
+			assert.False(t, r.Headers.Has("Content-Encoding"), name)
+			assert.False(t, r.Headers.Has("Content-Length"), name)
+		}
+	}
+
+	// Test: A chunked gzip body, read in small pieces
+	body := gzipped(payload)
+	data := "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: GZIP\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		fmt.Sprintf("%x\r\n%s\r\n%x\r\n%s\r\n0\r\n\r\n", 10, body[:10], len(body)-10, body[10:])
+	p := NewParser(&chunkReader{data: data, numBytesPerRead: 3}, DefaultLimits)
+	r, err := p.Next()
+	require.NoError(t, err)
+	got, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, string(payload), string(got))
+	// Test: No content, nothing to decode
+	for _, data := range []string{
+		"DELETE /item HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: gzip\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: gzip\r\n\r\n",
+		postWith("gzip", nil),
+	} {
+		r, err := StreamRequestFromReader(strings.NewReader(data), DefaultLimits)
+		require.NoError(t, err, data)
+		got, err := r.ReadBody()
+		require.NoError(t, err, data)
+		assert.Empty(t, got, data)
+		assert.Nil(t, r.ContentEncoding, data)
+	}
+}
+
+func TestContentEncodingErrors(t *testing.T) {
+	statusOf := func(err error) int {
+		var perr *ParseError
+		require.True(t, errors.As(err, &perr), "%v", err)
+		return perr.StatusCode
+	}
+
+	// Test: An unknown coding is refused before the handler sees the body
+	_, err := StreamRequestFromReader(strings.NewReader(postWith("br", []byte("x"))), DefaultLimits)
+	require.ErrorIs(t, err, ErrUnsupportedContentEncoding)
+	assert.Equal(t, 415, statusOf(err))
+
+	_, err = StreamRequestFromReader(strings.NewReader(postWith("gzip, gzip, gzip, gzip", []byte("x"))), DefaultLimits)
+	require.ErrorIs(t, err, ErrUnsupportedContentEncoding)
+
+	// Test: Bytes that aren't what they claim to be
+	for name, data := range map[string]string{
+		"not gzip":       postWith("gzip", []byte("plain text, honest")),
+		"truncated gzip": postWith("gzip", gzipped([]byte("hello"))[:12]),
+	} {
+		r, err := StreamRequestFromReader(strings.NewReader(data), DefaultLimits)
+		require.NoError(t, err, name)
+		_, err = r.ReadBody()
+		require.ErrorIs(t, err, ErrMalformedContentEncoding, name)
+		assert.Equal(t, 400, statusOf(err), name)
+	}
+
+	// Test: A zip bomb stops at the decoded limit
+	bomb := gzipped(make([]byte, 1<<20))
+	limits := DefaultLimits
+	limits.MaxDecodedBody = 64 * 1024
+	r, err := StreamRequestFromReader(strings.NewReader(postWith("gzip", bomb)), limits)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.Equal(t, 413, statusOf(err))
+}
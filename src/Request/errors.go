@@ -0,0 +1,77 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	headers "github/gojogourav/http-from-scratch/Headers"
+	"io"
+)
+
+// ParseError is what StreamRequestFromReader and the body reader return when
+// the request can't be parsed. Err is the detailed error and still matches
+// the Err* values with errors.Is, Reason is short enough to send back to the
+// client.
+type ParseError struct {
+	StatusCode int
+	Reason     string
+	Err        error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// statusCodes maps every error class to the status we'd respond with
+var statusCodes = []struct {
+	err    error
+	status int
+}{
+	{ErrMalformedRequestLine, 400},
+	{ErrMalformedRequestTarget, 400},
+	{ErrInvalidEscape, 400},
+	{ErrInvalidContentLength, 400},
+	{ErrMalformedChunk, 400},
+	{ErrConflictingContentLength, 400},
+	{ErrAmbiguousFraming, 400},
+	{ErrUnsupportedTransferEncoding, 501},
+	{ErrUnsupportedContentEncoding, 415},
+	{ErrMalformedContentEncoding, 400},
+	{io.ErrUnexpectedEOF, 400},
+	{ErrRequestLineTooLong, 414},
+	{ErrHeadersTooLarge, 431},
+	{ErrBodyTooLarge, 413},
+	{ErrUnsupportedHTTPVersion, 505},
+}
+
+// wrapError classifies err into a *ParseError. Errors that didn't come from
+// parsing (a reset connection, a read timeout...) are returned untouched.
+func wrapError(err error) error {
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		return err
+	}
+
+	var herr *headers.ParseError
+	if errors.As(err, &herr) {
+		return &ParseError{
+			StatusCode: herr.StatusCode,
+			Reason:     herr.Reason,
+			Err:        fmt.Errorf("%w : %w", ErrMalformedHeader, err),
+		}
+	}
+
+	for _, sc := range statusCodes {
+		if errors.Is(err, sc.err) {
+			return &ParseError{
+				StatusCode: sc.status,
+				Reason:     sc.err.Error(),
+				Err:        err,
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,438 @@
+package request
+
+import (
+	"bytes"
+	"fmt"
+	headers "github/gojogourav/http-from-scratch/Headers"
+	"io"
+	"os"
+)
+
+// MultipartForm is a parsed multipart/form-data body. Files that didn't fit
+// in memory live in temp files until RemoveAll is called.
+type MultipartForm struct {
+	Value Values
+	File  map[string][]*FileHeader
+}
+
+// FileHeader describes one uploaded file, Header holds the part's own
+// headers (Content-Disposition, Content-Type...).
+type FileHeader struct {
+	Filename string
+	Header   headers.Headers
+	Size     int64
+
+	content []byte
+	tmpfile string
+}
+
+// MultipartLimits bounds what ParseMultipartForm accepts, zero means no
+// limit except for MaxMemory.
+type MultipartLimits struct {
+	MaxMemory   int64 // part data kept in memory, files spill to disk past it
+	MaxFileSize int64 // size of a single file
+	MaxTotal    int64 // every part together, files and values
+}
+
+var DefaultMultipartLimits = MultipartLimits{
+	MaxMemory:   10 * 1024 * 1024,
+	MaxFileSize: 100 * 1024 * 1024,
+	MaxTotal:    200 * 1024 * 1024,
+}
+
+var (
+	ErrNotMultipart       = fmt.Errorf("Request Content-Type isn't multipart/form-data")
+	ErrMalformedMultipart = fmt.Errorf("Malformed multipart body")
+	ErrFileTooLarge       = fmt.Errorf("Uploaded file too large")
+	ErrFormTooLarge       = fmt.Errorf("Form too large")
+)
+
+// ParseForm fills Form with the query values and, for url-encoded bodies,
+// PostForm with the body values. Body values come first in Form.
+func (r *Request) ParseForm() error {
+	if r.Form != nil {
+		return nil
+	}
+	r.PostForm = Values{}
+	r.Form = Values{}
+
+	mediaType, _, _ := r.Headers.ContentType()
+	if mediaType == "application/x-www-form-urlencoded" {
+		body, err := r.ReadBody()
+		if err != nil {
+			return err
+		}
+		values, err := ParseQuery(string(body))
+		if err != nil {
+			return err
+		}
+		r.PostForm = values
+	}
+
+	for k, vs := range r.PostForm {
+		r.Form[k] = append(r.Form[k], vs...)
+	}
+	if r.URL != nil {
+		for k, vs := range r.URL.Query {
+			r.Form[k] = append(r.Form[k], vs...)
+		}
+	}
+	return nil
+}
+
+// FormValue is the first value for key from the query or the body.
+func (r *Request) FormValue(key string) string {
+	if r.Form == nil {
+		r.ParseForm()
+	}
+	return r.Form.Get(key)
+}
+
+// ParseMultipartForm streams a multipart/form-data body into MultipartForm.
+// Values also end up in Form and PostForm.
+func (r *Request) ParseMultipartForm(limits MultipartLimits) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+	mediaType, params, err := r.Headers.ContentType()
+	if err != nil || mediaType != "multipart/form-data" {
+		return ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" || len(boundary) > 70 {
+		return ErrMalformedMultipart
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	form := &MultipartForm{
+		Value: Values{},
+		File:  map[string][]*FileHeader{},
+	}
+	mr := newMultipartReader(r.BodyReader, boundary)
+	memoryLeft := limits.MaxMemory
+	var total int64
+
+	for {
+		part, err := mr.nextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			form.RemoveAll()
+			return err
+		}
+
+		disposition, dparams, _ := headers.ParseMediaType(part.header.Get("Content-Disposition"))
+		name := dparams["name"]
+		if disposition != "form-data" || name == "" {
+			// not a form field, skip it
+			if _, err := io.Copy(io.Discard, part); err != nil {
+				form.RemoveAll()
+				return err
+			}
+			continue
+		}
+
+		var remaining int64 = -1
+		if limits.MaxTotal > 0 {
+			remaining = limits.MaxTotal - total
+		}
+
+		filename, isFile := dparams["filename"]
+		if !isFile {
+			// plain values always stay in memory, so they count against it
+			limit := memoryLeft
+			if remaining >= 0 && remaining < limit {
+				limit = remaining
+			}
+			value, err := readAtMost(part, limit)
+			if err != nil {
+				form.RemoveAll()
+				return err
+			}
+			memoryLeft -= int64(len(value))
+			total += int64(len(value))
+			form.Value.Add(name, string(value))
+			continue
+		}
+
+		fh := &FileHeader{
+			Filename: filename,
+			Header:   part.header,
+		}
+		if err := fh.store(part, &memoryLeft, limits.MaxFileSize, remaining); err != nil {
+			fh.remove()
+			form.RemoveAll()
+			return err
+		}
+		total += fh.Size
+		form.File[name] = append(form.File[name], fh)
+	}
+
+	for k, vs := range form.Value {
+		r.Form[k] = append(r.Form[k], vs...)
+		r.PostForm[k] = append(r.PostForm[k], vs...)
+	}
+	r.MultipartForm = form
+	return nil
+}
+
+// FormFile opens the first file uploaded under key.
+func (r *Request) FormFile(key string) (io.ReadCloser, *FileHeader, error) {
+	if r.MultipartForm == nil {
+		if err := r.ParseMultipartForm(DefaultMultipartLimits); err != nil {
+			return nil, nil, err
+		}
+	}
+	files := r.MultipartForm.File[key]
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no file uploaded as %q", key)
+	}
+	f, err := files[0].Open()
+	return f, files[0], err
+}
+
+// RemoveAll deletes the temp files backing the form.
+func (f *MultipartForm) RemoveAll() error {
+	var firstErr error
+	for _, fhs := range f.File {
+		for _, fh := range fhs {
+			if err := fh.remove(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (fh *FileHeader) Open() (io.ReadCloser, error) {
+	if fh.tmpfile != "" {
+		return os.Open(fh.tmpfile)
+	}
+	return io.NopCloser(bytes.NewReader(fh.content)), nil
+}
+
+// store keeps the file in memory while memoryLeft allows it and moves it to
+// a temp file after that. remaining is what's left of the total budget, -1
+// when there's none.
+func (fh *FileHeader) store(part io.Reader, memoryLeft *int64, maxFile, remaining int64) error {
+	limit := remaining
+	if maxFile > 0 && (limit < 0 || maxFile < limit) {
+		limit = maxFile
+	}
+	tooLarge := ErrFormTooLarge
+	if maxFile > 0 && limit == maxFile {
+		tooLarge = ErrFileTooLarge
+	}
+	if limit >= 0 {
+		// one byte more than allowed tells us the limit was crossed
+		part = io.LimitReader(part, limit+1)
+	}
+
+	inMemory := *memoryLeft
+	if inMemory < 0 {
+		inMemory = 0
+	}
+	content, err := io.ReadAll(io.LimitReader(part, inMemory+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(content)) <= inMemory {
+		if limit >= 0 && int64(len(content)) > limit {
+			return tooLarge
+		}
+		fh.content = content
+		fh.Size = int64(len(content))
+		*memoryLeft -= fh.Size
+		return nil
+	}
+
+	f, err := os.CreateTemp("", "multipart-")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fh.tmpfile = f.Name()
+	n, err := io.Copy(f, io.MultiReader(bytes.NewReader(content), part))
+	if err != nil {
+		return err
+	}
+	if limit >= 0 && n > limit {
+		return tooLarge
+	}
+	fh.Size = n
+	return nil
+}
+
+func (fh *FileHeader) remove() error {
+	if fh.tmpfile == "" {
+		return nil
+	}
+	err := os.Remove(fh.tmpfile)
+	fh.tmpfile = ""
+	return err
+}
+
+// readAtMost reads all of r but fails with ErrFormTooLarge past limit bytes
+func readAtMost(r io.Reader, limit int64) ([]byte, error) {
+	if limit < 0 {
+		limit = 0
+	}
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, ErrFormTooLarge
+	}
+	return b, nil
+}
+
+// multipartReader splits a multipart body into parts as it streams in. A
+// part ends at CRLF "--" boundary, the body ends at the boundary followed by
+// "--".
+type multipartReader struct {
+	reader    io.Reader
+	buf       []byte
+	readBuf   []byte
+	delimiter []byte // "\r\n--boundary"
+	err       error
+	started   bool
+	done      bool
+	current   *part
+}
+
+type part struct {
+	mr     *multipartReader
+	header headers.Headers
+	done   bool
+}
+
+func newMultipartReader(reader io.Reader, boundary string) *multipartReader {
+	return &multipartReader{
+		reader:    reader,
+		readBuf:   make([]byte, 4096),
+		delimiter: []byte("\r\n--" + boundary),
+	}
+}
+
+// fill reads more of the body, running out of body before the closing
+// delimiter means the multipart body was cut short
+func (mr *multipartReader) fill() error {
+	if mr.err != nil {
+		return mr.err
+	}
+	n, err := mr.reader.Read(mr.readBuf)
+	mr.buf = append(mr.buf, mr.readBuf[:n]...)
+	if err != nil {
+		if err == io.EOF {
+			err = ErrMalformedMultipart
+		}
+		mr.err = err
+		if n > 0 {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (mr *multipartReader) nextPart() (*part, error) {
+	if mr.done {
+		return nil, io.EOF
+	}
+	if mr.current != nil && !mr.current.done {
+		if _, err := io.Copy(io.Discard, mr.current); err != nil {
+			return nil, err
+		}
+	}
+
+	if !mr.started {
+		// the first delimiter may come without its CRLF, skip any preamble
+		dashBoundary := mr.delimiter[2:]
+		for {
+			if bytes.HasPrefix(mr.buf, dashBoundary) {
+				mr.buf = mr.buf[len(dashBoundary):]
+				break
+			}
+			if idx := bytes.Index(mr.buf, mr.delimiter); idx != -1 {
+				mr.buf = mr.buf[idx+len(mr.delimiter):]
+				break
+			}
+			if err := mr.fill(); err != nil {
+				return nil, err
+			}
+		}
+		mr.started = true
+	}
+
+	// after a delimiter comes either "--" for the end or padding and CRLF
+	for {
+		if len(mr.buf) >= 2 && string(mr.buf[:2]) == "--" {
+			mr.done = true
+			return nil, io.EOF
+		}
+		trimmed := bytes.TrimLeft(mr.buf, " \t")
+		if len(trimmed) >= 2 {
+			if string(trimmed[:2]) != SEPERATOR {
+				return nil, ErrMalformedMultipart
+			}
+			mr.buf = trimmed[2:]
+			break
+		}
+		if err := mr.fill(); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &part{mr: mr, header: *headers.NewHeaders()}
+	for {
+		n, done, err := p.header.Parse(mr.buf)
+		if err != nil {
+			return nil, fmt.Errorf("%w : %w", ErrMalformedMultipart, err)
+		}
+		mr.buf = mr.buf[n:]
+		if done {
+			break
+		}
+		if len(mr.buf) > 16*1024 {
+			return nil, ErrMalformedMultipart
+		}
+		if err := mr.fill(); err != nil {
+			return nil, err
+		}
+	}
+	mr.current = p
+	return p, nil
+}
+
+// Read hands out part data up to the next delimiter. Bytes that could be the
+// start of a delimiter split across reads are held back until it's clear.
+func (p *part) Read(b []byte) (int, error) {
+	if p.done {
+		return 0, io.EOF
+	}
+	mr := p.mr
+	for {
+		if idx := bytes.Index(mr.buf, mr.delimiter); idx != -1 {
+			if idx == 0 {
+				mr.buf = mr.buf[len(mr.delimiter):]
+				p.done = true
+				return 0, io.EOF
+			}
+			n := copy(b, mr.buf[:idx])
+			mr.buf = mr.buf[n:]
+			return n, nil
+		}
+		if safe := len(mr.buf) - len(mr.delimiter) + 1; safe > 0 {
+			n := copy(b, mr.buf[:safe])
+			mr.buf = mr.buf[n:]
+			return n, nil
+		}
+		if err := mr.fill(); err != nil {
+			return 0, err
+		}
+	}
+}
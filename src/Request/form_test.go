@@ -0,0 +1,130 @@
+package request
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForm(t *testing.T) {
+	body := "name=gojo&tags=a&tags=b+c&note=100%25"
+	r, err := RequestFromReader(strings.NewReader("POST /submit?tags=q&page=2 HTTP/1.1\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"Content-Length: 37\r\n" +
+		"\r\n" + body))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "gojo", r.PostForm.Get("name"))
+	assert.Equal(t, "100%", r.PostForm.Get("note"))
+	assert.Equal(t, []string{"a", "b c"}, r.PostForm["tags"])
+	assert.Equal(t, []string{"a", "b c", "q"}, r.Form["tags"])
+	assert.Equal(t, "2", r.FormValue("page"))
+	assert.False(t, r.PostForm.Has("page"))
+
+	// Test: Other content types only get the query
+	r, err = RequestFromReader(strings.NewReader("POST /submit?a=1 HTTP/1.1\r\n" +
+		"Content-Type: application/json\r\n" +
+		"Content-Length: 2\r\n" +
+		"\r\n{}"))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "1", r.Form.Get("a"))
+	assert.Empty(t, r.PostForm)
+}
+
+func multipartRequest(t *testing.T, limits Limits, perRead int) *Request {
+	body := "preamble to ignore\r\n" +
+		"--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"title\"\r\n" +
+		"\r\n" +
+		"my video\r\n" +
+		"--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"upload\"; filename=\"vim.txt\"\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"line one\r\n--XyNot a boundary\r\nline three\r\n" +
+		"--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"upload\"; filename=\"empty.txt\"\r\n" +
+		"\r\n" +
+		"\r\n" +
+		"--XyZ--\r\n" +
+		"epilogue"
+	data := "POST /upload HTTP/1.1\r\n" +
+		"Content-Type: multipart/form-data; boundary=XyZ\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n"
+	for len(body) > 0 {
+		n := min(len(body), 16)
+		data += fmt.Sprintf("%x\r\n%s\r\n", n, body[:n])
+		body = body[n:]
+	}
+	data += "0\r\n\r\n"
+
+	r, err := StreamRequestFromReader(&chunkReader{data: data, numBytesPerRead: perRead}, limits)
+	require.NoError(t, err)
+	return r
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	for _, perRead := range []int{1, 5, 4096} {
+		r := multipartRequest(t, DefaultLimits, perRead)
+		require.NoError(t, r.ParseMultipartForm(DefaultMultipartLimits))
+		form := r.MultipartForm
+		assert.Equal(t, "my video", form.Value.Get("title"))
+		assert.Equal(t, "my video", r.FormValue("title"))
+
+		files := form.File["upload"]
+		require.Len(t, files, 2)
+		assert.Equal(t, "vim.txt", files[0].Filename)
+		assert.Equal(t, "text/plain", files[0].Header.Get("Content-Type"))
+		f, err := files[0].Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, "line one\r\n--XyNot a boundary\r\nline three", string(content))
+		assert.Equal(t, int64(len(content)), files[0].Size)
+
+		assert.Equal(t, "empty.txt", files[1].Filename)
+		assert.Equal(t, int64(0), files[1].Size)
+	}
+
+	// Test: Files over MaxMemory go to a temp file that RemoveAll deletes
+	r := multipartRequest(t, DefaultLimits, 7)
+	require.NoError(t, r.ParseMultipartForm(MultipartLimits{MaxMemory: 10}))
+	fh := r.MultipartForm.File["upload"][0]
+	require.NotEmpty(t, fh.tmpfile)
+	f, err := fh.Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(f)
+	f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "line one\r\n--XyNot a boundary\r\nline three", string(content))
+	tmp := fh.tmpfile
+	require.NoError(t, r.MultipartForm.RemoveAll())
+	_, err = os.Stat(tmp)
+	assert.True(t, os.IsNotExist(err))
+
+	// Test: Per-file and total limits
+	r = multipartRequest(t, DefaultLimits, 7)
+	err = r.ParseMultipartForm(MultipartLimits{MaxMemory: 1024, MaxFileSize: 10})
+	require.ErrorIs(t, err, ErrFileTooLarge)
+
+	r = multipartRequest(t, DefaultLimits, 7)
+	err = r.ParseMultipartForm(MultipartLimits{MaxMemory: 1024, MaxTotal: 20})
+	require.ErrorIs(t, err, ErrFormTooLarge)
+
+	// Test: Not multipart, or cut short
+	r, err = StreamRequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Type: text/plain\r\nContent-Length: 0\r\n\r\n"), DefaultLimits)
+	require.NoError(t, err)
+	require.ErrorIs(t, r.ParseMultipartForm(DefaultMultipartLimits), ErrNotMultipart)
+
+	body := "--b\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nno end"
+	r, err = StreamRequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Type: multipart/form-data; boundary=b\r\nContent-Length: 52\r\n\r\n"+body), DefaultLimits)
+	require.NoError(t, err)
+	require.Error(t, r.ParseMultipartForm(DefaultMultipartLimits))
+}
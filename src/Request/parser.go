@@ -0,0 +1,162 @@
+package request
+
+import (
+	"fmt"
+	"io"
+)
+
+// Parser reads consecutive requests off one connection. Whatever was read
+// past the end of a request stays in its buffer for the next one, so
+// pipelined requests aren't lost.
+type Parser struct {
+	Limits Limits
+	// Lenient accepts bare LF line endings, obs-fold, repeated identical
+	// Content-Length fields and Content-Length next to Transfer-Encoding.
+	// Requests with the last two are served but close the connection.
+	Lenient bool
+
+	reader  io.Reader
+	buf     []byte
+	readBuf []byte
+	// sticky read error, only reported once buf has nothing left to give
+	err     error
+	current *Request
+}
+
+var ErrUnreadBody = fmt.Errorf("Previous request body not fully read")
+
+func NewParser(reader io.Reader, limits Limits) *Parser {
+	return &Parser{
+		Limits:  limits,
+		reader:  reader,
+		buf:     make([]byte, 0, 4096),
+		readBuf: make([]byte, 1024),
+	}
+}
+
+// Next parses the next request line and headers. The body of the previous
+// request has to be read (or discarded) first, Next fails with
+// ErrUnreadBody otherwise. A connection closed cleanly between requests
+// gives io.EOF.
+func (p *Parser) Next() (*Request, error) {
+	if p.current != nil && (p.current.state != StateDone || len(p.current.body) > 0) {
+		return nil, ErrUnreadBody
+	}
+
+	req := newRequest(p.Limits)
+	req.lenient = p.Lenient
+	started := len(p.buf) > 0
+
+	for {
+		// whatever is buffered goes first, it may already hold a whole
+		// pipelined request and reading would block for nothing
+		consumed, parseErr := req.parse(p.buf)
+		if parseErr != nil {
+			return nil, wrapError(parseErr)
+		}
+		p.buf = p.buf[consumed:]
+		if req.state > StateHeaders {
+			// fmt.Printf("Request parsing donee\n")
+			break
+		}
+
+		if readErr := p.fill(); readErr != nil {
+			if readErr == io.EOF {
+				// fmt.Printf("kya mujhe eor error arha hai?  %d\n ", consumed)
+				if !started {
+					// the client went away between requests, that's not an error on its part
+					return nil, io.EOF
+				}
+				return nil, wrapError(io.ErrUnexpectedEOF)
+			}
+			return nil, readErr
+		}
+		if len(p.buf) > 0 {
+			started = true
+		}
+
+		//if readErr and consumed is nil,0 -> it'll repeat again //VERY VERY IMPORTANT TO GRASP THIS
+		//THIS IS SOUL OF OUR PROGRAM
+	}
+
+	req.stream = &bodyReader{req: req, parser: p}
+	req.BodyReader = req.stream
+	p.current = req
+	if err := req.decodeContent(); err != nil {
+		return nil, wrapError(err)
+	}
+	return req, nil
+}
+
+// fill does one read from the connection into buf. A read that returns data
+// and an error together hands over the data now and the error next time.
+func (p *Parser) fill() error {
+	if p.err != nil {
+		return p.err
+	}
+	n, err := p.reader.Read(p.readBuf)
+	p.buf = append(p.buf, p.readBuf[:n]...)
+	if err != nil {
+		p.err = err
+		if n > 0 {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// bodyReader feeds bytes from the connection through the body states of the
+// parser, only reading from the connection when nothing decoded is pending.
+type bodyReader struct {
+	req    *Request
+	parser *Parser
+	closed bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyClosed
+	}
+	if send := b.req.sendContinue; send != nil {
+		b.req.sendContinue = nil
+		if err := send(); err != nil {
+			return 0, err
+		}
+	}
+	return b.read(p)
+}
+
+func (b *bodyReader) read(p []byte) (int, error) {
+	for {
+		if len(b.req.body) > 0 {
+			n := copy(p, b.req.body)
+			b.req.body = b.req.body[n:]
+			return n, nil
+		}
+		if b.req.state == StateDone {
+			return 0, io.EOF
+		}
+
+		consumed, err := b.req.parse(b.parser.buf)
+		if err != nil {
+			return 0, wrapError(err)
+		}
+		b.parser.buf = b.parser.buf[consumed:]
+		if consumed > 0 {
+			continue
+		}
+
+		if err := b.parser.fill(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, wrapError(err)
+		}
+	}
+}
+
+func (b *bodyReader) Close() error {
+	b.closed = true
+	return nil
+}
@@ -0,0 +1,55 @@
+package request
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserPipelining(t *testing.T) {
+	data := "GET /first HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+		"POST /second HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhello" +
+		"POST /third HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n" +
+		"GET /fourth HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"
+
+	for _, perRead := range []int{1, 7, len(data)} {
+		p := NewParser(&chunkReader{data: data, numBytesPerRead: perRead}, DefaultLimits)
+
+		r, err := p.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "/first", r.URL.Path)
+
+		r, err = p.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "/second", r.URL.Path)
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(body))
+
+		// Test: Next refuses to skip an unread body
+		r, err = p.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "/third", r.URL.Path)
+		_, err = p.Next()
+		require.ErrorIs(t, err, ErrUnreadBody)
+		require.NoError(t, r.DiscardBody(1024))
+
+		r, err = p.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "/fourth", r.URL.Path)
+
+		_, err = p.Next()
+		require.Equal(t, io.EOF, err)
+	}
+}
+
+func TestParserTruncatedRequest(t *testing.T) {
+	p := NewParser(strings.NewReader("GET / HTTP/1.1\r\n\r\nGET /half HTTP/1.1\r\nHo"), DefaultLimits)
+	_, err := p.Next()
+	require.NoError(t, err)
+	_, err = p.Next()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -15,35 +15,108 @@ type RequestLine struct {
 	HttpVersion   string
 }
 
-func (rl *RequestLine) ValidHTTPVersion() bool {
+// Version splits HTTP-version ("HTTP/" DIGIT "." DIGIT) into its numbers,
+// ok is false when it isn't of that shape at all
+func (rl *RequestLine) Version() (major, minor int, ok bool) {
 	part := strings.Split(rl.HttpVersion, "/")
-	if len(part) != 2 {
-		return false
+	if len(part) != 2 || part[0] != "HTTP" {
+		return 0, 0, false
+	}
+	v := part[1]
+	if len(v) != 3 || v[1] != '.' || v[0] < '0' || v[0] > '9' || v[2] < '0' || v[2] > '9' {
+		return 0, 0, false
 	}
-	return (part[0] == "HTTP") && (part[1] == "1.1")
+	return int(v[0] - '0'), int(v[2] - '0'), true
+}
 
+// ValidHTTPVersion accepts HTTP/1.0 and HTTP/1.1, any other HTTP/1.x is
+// served as HTTP/1.1
+func (rl *RequestLine) ValidHTTPVersion() bool {
+	major, _, ok := rl.Version()
+	return ok && major == 1
+}
+
+// ResponseVersion is the version we answer with, HTTP/1.0 clients get an
+// HTTP/1.0 response and everyone else HTTP/1.1
+func (rl *RequestLine) ResponseVersion() string {
+	if _, minor, _ := rl.Version(); minor == 0 {
+		return "HTTP/1.0"
+	}
+	return "HTTP/1.1"
 }
 
 type parserState int
 
 const (
-	StateRequestLine parserState = iota //0
-	StateHeaders                        //1
-	StateBody                           //2
-	StateDone                           //3
+	StateRequestLine  parserState = iota //0
+	StateHeaders                         //1
+	StateBody                            //2
+	StateChunkSize                       //3
+	StateChunkData                       //4
+	StateChunkDataEnd                    //5
+	StateTrailers                        //6
+	StateDone                            //7
 )
 
 type Request struct {
 	RequestLine RequestLine
+	URL         *URL
 	Headers     headers.Headers
-	Body        []byte
-	state       parserState
+	Trailers    headers.Headers
+
+	// BodyReader streams the decoded body as it arrives on the connection.
+	// Body is only filled once the whole body is read, either by
+	// RequestFromReader or by calling ReadBody.
+	BodyReader io.ReadCloser
+	Body       []byte
+	// ContentEncoding lists the codings BodyReader undoes, in the order
+	// the client applied them. Content-Encoding and Content-Length are
+	// dropped from Headers when there are any.
+	ContentEncoding []string
+
+	// filled by ParseForm and ParseMultipartForm
+	Form          Values
+	PostForm      Values
+	MultipartForm *MultipartForm
+
+	state        parserState
+	stream       *bodyReader
+	sendContinue func() error
+	bodyBuffered bool
+	limits       Limits
+	lenient      bool
+	// framing was questionable, don't reuse the connection
+	closeAfter bool
+
+	headerBytes  int
+	trailerBytes int
+	// decoded bytes of a chunked body so far, for MaxBody
+	bodyRead int64
+
+	// decoded body bytes that haven't been handed to the reader yet
+	body []byte
+	// bytes of a Content-Length body still expected
+	bodyRemaining int64
+	// bytes left in the chunk currently being read
+	chunkRemaining uint64
 }
 
 var (
 	ErrMalformedRequestLine = fmt.Errorf("Malformed request line")
 	ErrInvalidContentLength = fmt.Errorf("Invalid Content-Length value")
 	ErrMalformedHeader      = fmt.Errorf("Malformed header")
+	ErrMalformedChunk       = fmt.Errorf("Malformed chunked encoding")
+	ErrBodyClosed           = fmt.Errorf("Read on closed body")
+	// the version is well formed but its major version isn't 1
+	ErrUnsupportedHTTPVersion = fmt.Errorf("Unsupported HTTP version")
+
+	ErrRequestLineTooLong = fmt.Errorf("Request line too long")
+	ErrHeadersTooLarge    = fmt.Errorf("Request header fields too large")
+	ErrBodyTooLarge       = fmt.Errorf("Request body too large")
+
+	ErrConflictingContentLength    = fmt.Errorf("Conflicting Content-Length values")
+	ErrAmbiguousFraming            = fmt.Errorf("Ambiguous message framing")
+	ErrUnsupportedTransferEncoding = fmt.Errorf("Unsupported transfer coding")
 )
 
 const (
@@ -51,25 +124,76 @@ const (
 	HEADER_END = SEPERATOR + SEPERATOR
 )
 
-func newRequest() *Request {
+// Limits bounds how much a client can make us buffer, a zero field means
+// no limit for that part of the request.
+type Limits struct {
+	MaxRequestLine int   // request line length, without the CRLF
+	MaxHeaderBytes int   // all header lines together, same for trailers
+	MaxHeaders     int   // number of header fields
+	MaxBody        int64 // decoded body size
+	MaxDecodedBody int64 // body size once Content-Encoding is undone
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLine: 8 * 1024,
+	MaxHeaderBytes: 64 * 1024,
+	MaxHeaders:     100,
+	MaxBody:        10 * 1024 * 1024,
+	MaxDecodedBody: 10 * 1024 * 1024,
+}
+
+// a chunk-size line is a few hex digits, the rest is extensions we ignore
+const maxChunkSizeLine = 4096
+
+// empty lines tolerated before the request line
+const maxLeadingEmptyLines = 2
+
+func newRequest(limits Limits) *Request {
 	return &Request{
-		Headers: *headers.NewHeaders(),
-		state:   StateRequestLine,
+		Headers:  *headers.NewHeaders(),
+		Trailers: *headers.NewHeaders(),
+		state:    StateRequestLine,
+		limits:   limits,
 	}
 }
 
 func (r *Request) parseRequestLine(data []byte) (int, *RequestLine, error) {
-	lineEnd := bytes.Index(data, []byte(SEPERATOR))
-	if lineEnd == -1 {
+	// clients may send a stray CRLF after a body, ignore a couple of those
+	skipped := 0
+	var line []byte
+	var n int
+	for i := 0; ; i++ {
+		var err error
+		line, n, err = headers.NextLine(data[skipped:], r.lenient)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%w : %w", ErrMalformedRequestLine, err)
+		}
+		if n == 0 || len(line) > 0 {
+			break
+		}
+		if i == maxLeadingEmptyLines {
+			return 0, nil, ErrMalformedRequestLine
+		}
+		skipped += n
+	}
+	if n == 0 {
+		if r.limits.MaxRequestLine > 0 && len(data)-skipped > r.limits.MaxRequestLine {
+			return 0, nil, ErrRequestLineTooLong
+		}
 		return 0, nil, nil //we send nil as we expect there is not enough data to be parsed
 	}
+	if r.limits.MaxRequestLine > 0 && len(line) > r.limits.MaxRequestLine {
+		return 0, nil, ErrRequestLineTooLong
+	}
 
-	line := string(data[:lineEnd])
 	// println(line)
-	parts := strings.Split(line, " ")
+	parts := strings.Split(string(line), " ")
 	if len(parts) != 3 {
 		return 0, nil, ErrMalformedRequestLine
 	}
+	if !headers.IsValidToken(parts[0]) || !isVisibleASCII(parts[1]) {
+		return 0, nil, ErrMalformedRequestLine
+	}
 
 	rl := &RequestLine{
 		Method:        parts[0],
@@ -82,11 +206,26 @@ func (r *Request) parseRequestLine(data []byte) (int, *RequestLine, error) {
 	// fmt.Println("THIS IS REQUEST TARGET - ", parts[1])
 	// fmt.Println("THIS IS HTTPVERSION  - ", parts[2])
 
+	if _, _, ok := rl.Version(); !ok {
+		return 0, nil, fmt.Errorf("%w : bad HTTP version %q", ErrMalformedRequestLine, rl.HttpVersion)
+	}
 	if !(rl.ValidHTTPVersion()) {
-		return 0, nil, fmt.Errorf("unsupported HTTP version: %s", rl.HttpVersion)
+		return 0, nil, fmt.Errorf("%w : %s", ErrUnsupportedHTTPVersion, rl.HttpVersion)
 	}
 
-	return lineEnd + len(SEPERATOR), rl, nil
+	return skipped + n, rl, nil
+}
+
+func isVisibleASCII(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] <= ' ' || s[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
 }
 
 // func (r *Request) String() string {
@@ -135,6 +274,10 @@ func (r *Request) parse(data []byte) (int, error) {
 				return 0, err
 			}
 			if consumedInStep > 0 {
+				r.URL, err = ParseRequestTarget(rl.Method, rl.RequestTarget)
+				if err != nil {
+					return 0, err
+				}
 				r.RequestLine = *rl
 				r.state = StateHeaders
 				consumed += consumedInStep
@@ -172,7 +315,7 @@ func (r *Request) parse(data []byte) (int, error) {
 
 			//keeping old code so i don't stay retarded
 
-			n, done, err := r.Headers.Parse(workingData)
+			n, done, err := r.parseFields(&r.Headers, workingData)
 
 			if err != nil {
 				// println("Error idhar arha hai kyaa")
@@ -180,40 +323,89 @@ func (r *Request) parse(data []byte) (int, error) {
 				return 0, err
 			}
 			consumedInStep = n
+			if err := r.checkHeaderLimits(&r.Headers, &r.headerBytes, n, done, len(workingData)-n); err != nil {
+				return 0, err
+			}
 			if done {
-				r.state = StateBody
+				if err := r.startBody(); err != nil {
+					return 0, err
+				}
 			}
 			// fmt.Println("EOF ENCOUNTERED?2 ", consumed+consumedInStep)
 			break
 
 		case StateBody:
-			contentLengthVal := r.Headers.Get("Content-Length")
-			if contentLengthVal == "" || contentLengthVal == "0" || len(contentLengthVal) == 0 {
-				// println("IS this executing ??????")
+			n := int64(len(workingData))
+			if n > r.bodyRemaining {
+				n = r.bodyRemaining
+			}
+			r.body = append(r.body, workingData[:n]...)
+			r.bodyRemaining -= n
+			consumedInStep = int(n)
+			if r.bodyRemaining == 0 {
 				r.state = StateDone
-				consumedInStep = 0
-			} else {
-
-				// println("ye hua content Length value - ", contentLengthVal)
-
-				length, err := strconv.Atoi(contentLengthVal)
-				if err != nil {
-					// println("Error idhar arha hai kyaa")
+			}
 
-					return 0, fmt.Errorf("%w : %s", ErrInvalidContentLength, err.Error())
+		// chunked body looks like
+		//   <hex size>[;ext]\r\n<data>\r\n ... 0\r\n<trailers>\r\n
+		case StateChunkSize:
+			lineEnd := bytes.Index(workingData, []byte(SEPERATOR))
+			if lineEnd == -1 {
+				if len(workingData) > maxChunkSizeLine {
+					return 0, ErrMalformedChunk
 				}
+				break
+			}
+			size, err := parseChunkSize(workingData[:lineEnd])
+			if err != nil {
+				return 0, err
+			}
+			if r.limits.MaxBody > 0 && size > uint64(r.limits.MaxBody-r.bodyRead) {
+				return 0, ErrBodyTooLarge
+			}
+			r.bodyRead += int64(size)
+			consumedInStep = lineEnd + len(SEPERATOR)
+			if size == 0 {
+				r.state = StateTrailers
+			} else {
+				r.chunkRemaining = size
+				r.state = StateChunkData
+			}
 
-				if length <= len(workingData) {
-					r.Body = workingData[:length]
-					consumedInStep = length
-					r.state = StateDone
+		case StateChunkData:
+			n := uint64(len(workingData))
+			if n > r.chunkRemaining {
+				n = r.chunkRemaining
+			}
+			r.body = append(r.body, workingData[:n]...)
+			r.chunkRemaining -= n
+			consumedInStep = int(n)
+			if r.chunkRemaining == 0 {
+				r.state = StateChunkDataEnd
+			}
 
-				} else {
-					consumedInStep = 0
-				}
-				// fmt.Println("EOF ENCOUNTERED?3")
+		case StateChunkDataEnd:
+			if len(workingData) < len(SEPERATOR) {
+				break
+			}
+			if !bytes.HasPrefix(workingData, []byte(SEPERATOR)) {
+				return 0, ErrMalformedChunk
+			}
+			consumedInStep = len(SEPERATOR)
+			r.state = StateChunkSize
+
+		case StateTrailers:
+			n, done, err := r.parseFields(&r.Trailers, workingData)
+			if err != nil {
+				return 0, err
+			}
+			consumedInStep = n
+			if err := r.checkHeaderLimits(&r.Trailers, &r.trailerBytes, n, done, len(workingData)-n); err != nil {
+				return 0, err
+			}
+			if done {
+				r.state = StateDone
 			}
-			break
 		}
 
 		if r.state == StateDone {
@@ -233,47 +425,200 @@ func (r *Request) parse(data []byte) (int, error) {
 	return consumed, nil
 }
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	req := newRequest()
-	buf := make([]byte, 0, 4096)
-	readBuf := make([]byte, 1024)
+// KeepAlive reports whether the connection may be reused after this request.
+// HTTP/1.1 is persistent unless the client sends "Connection: close",
+// HTTP/1.0 only when it asks for "Connection: keep-alive".
+func (r *Request) KeepAlive() bool {
+	_, minor, _ := r.RequestLine.Version()
+	if r.closeAfter || r.Headers.HasToken("Connection", "close") {
+		return false
+	}
+	if minor == 0 {
+		return r.Headers.HasToken("Connection", "keep-alive")
+	}
+	return true
+}
 
-	for {
-		n, readErr := reader.Read(readBuf)
-		// fmt.Errorf((readErr.Error()))
-		if n > 0 {
-			buf = append(buf, readBuf[:n]...)
-		}
-		// if err != nil {
-		// 	return nil, err
-		// }
-		consumed, parseErr := req.parse(buf)
+// Expect is the request's expectation, "" when there is none or the client
+// speaks HTTP/1.0 (which has no Expect). The only one defined is
+// "100-continue", anything else should get a 417.
+func (r *Request) Expect() string {
+	if _, minor, _ := r.RequestLine.Version(); minor == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(r.Headers.Get("Expect")))
+}
+
+// OnContinue registers send to be called right before the body is first
+// read, so "100 Continue" only goes out once a handler actually wants the
+// body. It does nothing unless the client sent "Expect: 100-continue".
+func (r *Request) OnContinue(send func() error) {
+	if r.Expect() == "100-continue" && r.state != StateDone {
+		r.sendContinue = send
+	}
+}
 
-		if parseErr != nil {
-			return nil, parseErr
+// WaitingForContinue reports whether the client is still holding back the
+// body because nobody read it and "100 Continue" never went out.
+func (r *Request) WaitingForContinue() bool {
+	return r.sendContinue != nil
+}
+
+// UnreadBody is how much of the body is still to come off the connection,
+// -1 for a chunked body that isn't over yet since its length isn't known
+func (r *Request) UnreadBody() int64 {
+	switch r.state {
+	case StateDone:
+		return 0
+	case StateBody:
+		return r.bodyRemaining
+	}
+	return -1
+}
+
+// checkHeaderLimits is run after every headers.Parse call, parsed is what
+// was just consumed and pending the partial line still waiting for its CRLF
+func (r *Request) checkHeaderLimits(h *headers.Headers, total *int, parsed int, done bool, pending int) error {
+	*total += parsed
+	if done {
+		pending = 0
+	}
+	if r.limits.MaxHeaderBytes > 0 && *total+pending > r.limits.MaxHeaderBytes {
+		return ErrHeadersTooLarge
+	}
+	if r.limits.MaxHeaders > 0 && h.Len() > r.limits.MaxHeaders {
+		return ErrHeadersTooLarge
+	}
+	return nil
+}
+
+// startBody picks the body framing once all headers are in, following
+// RFC 9112 section 6.3. Anything that could let a proxy in front of us frame
+// the request differently is rejected, or in lenient mode resolved the way
+// the RFC says and the connection closed afterwards.
+func (r *Request) startBody() error {
+	te := r.Headers.Get("Transfer-Encoding")
+
+	// a field that's there but blank still counts, it's no body length
+	// either way and a proxy may read it differently than we would
+	if r.Headers.Has("Transfer-Encoding") {
+		if r.Headers.Has("Content-Length") {
+			if !r.lenient {
+				return ErrAmbiguousFraming
+			}
+			// Transfer-Encoding wins over Content-Length
+			r.Headers.Del("Content-Length")
+			r.closeAfter = true
+		}
+		if _, minor, _ := r.RequestLine.Version(); minor == 0 {
+			// HTTP/1.0 has no Transfer-Encoding, whoever sent it is confused
+			if !r.lenient {
+				return ErrAmbiguousFraming
+			}
+			r.closeAfter = true
 		}
-		if consumed > 0 {
-			buf = buf[consumed:]
+		codings := r.Headers.Tokens("Transfer-Encoding")
+		if len(codings) == 0 || !strings.EqualFold(codings[len(codings)-1], "chunked") {
+			// without chunked last the body length can't be known
+			return fmt.Errorf("%w : %s", ErrAmbiguousFraming, te)
 		}
-		if req.state == StateDone {
-			// fmt.Printf("Request parsing donee\n")
-			break
+		if len(codings) > 1 {
+			return fmt.Errorf("%w : %s", ErrUnsupportedTransferEncoding, te)
 		}
+		r.state = StateChunkSize
+		return nil
+	}
 
-		if readErr != nil {
-			if readErr == io.EOF {
-				if req.state != StateDone {
+	if !r.Headers.Has("Content-Length") {
+		r.state = StateDone
+		return nil
+	}
+	length, err := r.parseContentLength()
+	if err != nil {
+		return err
+	}
+	if r.limits.MaxBody > 0 && length > r.limits.MaxBody {
+		return ErrBodyTooLarge
+	}
+	r.bodyRemaining = length
+	if length == 0 {
+		r.state = StateDone
+	} else {
+		r.state = StateBody
+	}
+	return nil
+}
 
-					// fmt.Printf("kya mujhe eor error arha hai?  %d\n ", consumed)
-					return nil, io.ErrUnexpectedEOF
-				}
-				break
+// parseContentLength accepts digits only. Repeated Content-Length fields
+// are refused in strict mode, lenient mode only takes them when they all
+// agree.
+func (r *Request) parseContentLength() (int64, error) {
+	value := r.Headers.Get("Content-Length")
+	values := r.Headers.Tokens("Content-Length")
+	if len(values) > 1 {
+		for _, v := range values[1:] {
+			if !r.lenient || v != values[0] {
+				return 0, fmt.Errorf("%w : %s", ErrConflictingContentLength, value)
 			}
-			return nil, readErr
 		}
+	}
+
+	length, err := r.Headers.ContentLength()
+	if err != nil || length < 0 {
+		return 0, fmt.Errorf("%w : %s", ErrInvalidContentLength, value)
+	}
+	return length, nil
+}
+
+// parseFields runs the headers parser matching our strictness
+func (r *Request) parseFields(h *headers.Headers, data []byte) (int, bool, error) {
+	if r.lenient {
+		return h.ParseLenient(data)
+	}
+	return h.Parse(data)
+}
+
+// parseChunkSize reads the hex size from a chunk-size line and ignores
+// any chunk extensions after ';'
+func parseChunkSize(line []byte) (uint64, error) {
+	sizePart := line
+	if idx := bytes.IndexByte(line, ';'); idx != -1 {
+		sizePart = line[:idx]
+	}
+	sizePart = bytes.TrimRight(sizePart, " \t")
+	if len(sizePart) == 0 || len(sizePart) > 16 {
+		return 0, ErrMalformedChunk
+	}
+	for _, ch := range sizePart {
+		if !isHex(ch) {
+			return 0, ErrMalformedChunk
+		}
+	}
+	size, err := strconv.ParseUint(string(sizePart), 16, 63)
+	if err != nil {
+		return 0, fmt.Errorf("%w : %s", ErrMalformedChunk, err.Error())
+	}
+	return size, nil
+}
 
-		//if readErr and consumed is nil,0 -> it'll repeat again //VERY VERY IMPORTANT TO GRASP THIS
-		//THIS IS SOUL OF OUR PROGRAM
+// StreamRequestFromReader parses the request line and headers and returns as
+// soon as they are complete, the body is left on the reader and is decoded
+// lazily through Request.BodyReader. Exceeding limits fails with one of
+// ErrRequestLineTooLong, ErrHeadersTooLarge or ErrBodyTooLarge.
+// Use a Parser to read more than one request from the same reader.
+func StreamRequestFromReader(reader io.Reader, limits Limits) (*Request, error) {
+	return NewParser(reader, limits).Next()
+}
+
+// RequestFromReader parses a whole request, body included, into memory,
+// using DefaultLimits.
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	req, err := StreamRequestFromReader(reader, DefaultLimits)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := req.ReadBody(); err != nil {
+		return nil, err
 	}
 
 	println("Requset Line :")
@@ -287,3 +632,43 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 
 	return req, nil
 }
+
+// ReadBody reads whatever is left of the body into Request.Body.
+// It's safe to call more than once.
+func (r *Request) ReadBody() ([]byte, error) {
+	if r.bodyBuffered {
+		return r.Body, nil
+	}
+	body, err := io.ReadAll(r.BodyReader)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = body
+	r.bodyBuffered = true
+	r.BodyReader = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// DiscardBody reads and drops whatever the handler left unread so the next
+// request on the connection starts at the right place. It gives up with
+// ErrBodyTooLarge after max bytes, the connection isn't worth saving then.
+func (r *Request) DiscardBody(max int64) error {
+	if r.stream == nil || r.bodyBuffered {
+		return nil
+	}
+	buf := make([]byte, 4096)
+	var discarded int64
+	for {
+		n, err := r.stream.read(buf)
+		discarded += int64(n)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if discarded > max {
+			return ErrBodyTooLarge
+		}
+	}
+}
@@ -124,3 +124,399 @@ func TestParseBody(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
 }
+
+func TestParseChunkedBody(t *testing.T) {
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\nhello \r\n" +
+			"7;name=value\r\nworld!\n\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+
+	// Test: Trailers after the last chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"1A\r\nabcdefghijklmnopqrstuvwxyz\r\n" +
+			"0\r\n" +
+			"X-Checksum: 1234\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", string(r.Body))
+	assert.Equal(t, "1234", r.Trailers.Get("x-checksum"))
+	assert.Equal(t, "", r.Headers.Get("x-checksum"))
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrMalformedChunk)
+
+	// Test: Chunk data longer than its declared size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrMalformedChunk)
+
+	// Test: Missing terminating chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestStreamBody(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 10\r\n\r\nhello"))
+		pw.Write([]byte("world"))
+		pw.Close()
+	}()
+
+	r, err := StreamRequestFromReader(pr, DefaultLimits)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Nil(t, r.Body)
+
+	// Test: the first part is readable before the rest is sent
+	buf := make([]byte, 5)
+	n, err := io.ReadFull(r.BodyReader, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(body))
+
+	// Test: chunked body through the reader
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\nhello \r\n" +
+			"7\r\nworld!\n\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = StreamRequestFromReader(reader, DefaultLimits)
+	require.NoError(t, err)
+	all, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(all))
+
+	// Test: reading after close fails
+	reader = &chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	r, err = StreamRequestFromReader(reader, DefaultLimits)
+	require.NoError(t, err)
+	require.NoError(t, r.BodyReader.Close())
+	_, err = r.BodyReader.Read(buf)
+	require.ErrorIs(t, err, ErrBodyClosed)
+}
+
+func TestHTTPVersions(t *testing.T) {
+	// Test: HTTP/1.0 is accepted and closes by default
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0", r.RequestLine.HttpVersion)
+	assert.Equal(t, "HTTP/1.0", r.RequestLine.ResponseVersion())
+	assert.False(t, r.KeepAlive())
+
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: HTTP/1.1 is persistent unless asked to close
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", r.RequestLine.ResponseVersion())
+	assert.True(t, r.KeepAlive())
+
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nConnection: upgrade, close\r\n\r\n"))
+	require.NoError(t, err)
+	assert.False(t, r.KeepAlive())
+
+	// Test: Other major versions are unsupported, garbage is malformed
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/2.0\r\nHost: localhost:42069\r\n\r\n"))
+	require.ErrorIs(t, err, ErrUnsupportedHTTPVersion)
+
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/1\r\nHost: localhost:42069\r\n\r\n"))
+	require.ErrorIs(t, err, ErrMalformedRequestLine)
+
+	_, err = RequestFromReader(strings.NewReader("GET / HTPT/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.ErrorIs(t, err, ErrMalformedRequestLine)
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLine: 32,
+		MaxHeaderBytes: 64,
+		MaxHeaders:     3,
+		MaxBody:        8,
+	}
+
+	// Test: Request line over the limit, with and without its CRLF
+	_, err := StreamRequestFromReader(strings.NewReader("GET /"+strings.Repeat("a", 40)+" HTTP/1.1\r\n\r\n"), limits)
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+	_, err = StreamRequestFromReader(strings.NewReader("GET /"+strings.Repeat("a", 100)), limits)
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Too many header bytes, even when the line never ends
+	_, err = StreamRequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nX-Big: "+strings.Repeat("a", 80)+"\r\n\r\n"), limits)
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+	_, err = StreamRequestFromReader(&chunkReader{data: "GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("a", 80), numBytesPerRead: 7}, limits)
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Too many header fields
+	_, err = StreamRequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n"), limits)
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Content-Length over the limit is rejected before the body is read
+	_, err = StreamRequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 9\r\n\r\n"), limits)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body over the limit
+	r, err := StreamRequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n5\r\nworld\r\n0\r\n\r\n"), limits)
+	if err == nil {
+		_, err = r.ReadBody()
+	}
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Everything within limits, body included
+	r, err = StreamRequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 8\r\n\r\n12345678"), limits)
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "12345678", string(body))
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		data   string
+		status int
+		err    error
+	}{
+		{"GET / HTTP/1.1 extra\r\n\r\n", 400, ErrMalformedRequestLine},
+		{"GET / HTTP/3.0\r\n\r\n", 505, ErrUnsupportedHTTPVersion},
+		{"GET / HTTP/1.1\r\nHost localhost\r\n\r\n", 400, ErrMalformedHeader},
+		{"GET / HTTP/1.1\r\nH©st: localhost\r\n\r\n", 400, ErrMalformedHeader},
+		{"POST / HTTP/1.1\r\nContent-Length: abc\r\n\r\n", 400, ErrInvalidContentLength},
+		{"GET / HTTP/1.1\r\nHost: loc", 400, io.ErrUnexpectedEOF},
+		{"POST / HTTP/1.1\r\nContent-Length: 999999999999\r\n\r\n", 413, ErrBodyTooLarge},
+	}
+	for _, c := range cases {
+		_, err := StreamRequestFromReader(strings.NewReader(c.data), DefaultLimits)
+		require.Error(t, err, c.data)
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr, c.data)
+		assert.Equal(t, c.status, perr.StatusCode, c.data)
+		assert.NotEmpty(t, perr.Reason)
+		assert.ErrorIs(t, err, c.err, c.data)
+	}
+
+	// Test: Errors while streaming the body are typed too
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"))
+		pw.Write([]byte("xyz\r\n"))
+		pw.Close()
+	}()
+	r, err := StreamRequestFromReader(pr, DefaultLimits)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	var perr *ParseError
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, 400, perr.StatusCode)
+	assert.ErrorIs(t, err, ErrMalformedChunk)
+}
+
+func TestDiscardBody(t *testing.T) {
+	// Test: A closed connection before any byte is a plain EOF
+	_, err := StreamRequestFromReader(strings.NewReader(""), DefaultLimits)
+	require.Equal(t, io.EOF, err)
+
+	// Test: Unread body is dropped even after the handler closed it
+	r, err := StreamRequestFromReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world",
+		numBytesPerRead: 3,
+	}, DefaultLimits)
+	require.NoError(t, err)
+	require.NoError(t, r.BodyReader.Close())
+	assert.Positive(t, r.UnreadBody())
+	require.NoError(t, r.DiscardBody(1024))
+	assert.Equal(t, int64(0), r.UnreadBody())
+
+	// Test: A chunked body's length isn't known before its end
+	r, err = StreamRequestFromReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}, DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), r.UnreadBody())
+	require.NoError(t, r.DiscardBody(1024))
+	assert.Equal(t, int64(0), r.UnreadBody())
+
+	// Test: Bodies bigger than the drain budget give up
+	r, err = StreamRequestFromReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world",
+		numBytesPerRead: 3,
+	}, DefaultLimits)
+	require.NoError(t, err)
+	require.ErrorIs(t, r.DiscardBody(4), ErrBodyTooLarge)
+}
+
+func TestExpectContinue(t *testing.T) {
+	pr, pw := io.Pipe()
+	sent := 0
+	go func() {
+		pw.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nExpect: 100-Continue\r\nContent-Length: 5\r\n\r\n"))
+		pw.Write([]byte("hello"))
+		pw.Close()
+	}()
+
+	r, err := StreamRequestFromReader(pr, DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, "100-continue", r.Expect())
+	r.OnContinue(func() error {
+		sent++
+		return nil
+	})
+	assert.True(t, r.WaitingForContinue())
+	assert.Equal(t, 0, sent)
+
+	// Test: Reading the body sends the interim response exactly once
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, 1, sent)
+	assert.False(t, r.WaitingForContinue())
+
+	// Test: HTTP/1.0 has no Expect
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.0\r\nExpect: 100-continue\r\nContent-Length: 0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "", r.Expect())
+
+	// Test: Unknown expectations are passed through for the server to reject
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nExpect: something-else\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "something-else", r.Expect())
+}
+
+func TestSmugglingStrict(t *testing.T) {
+	rejected := map[string]error{
+		// duplicated or conflicting Content-Length
+		"POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello":  ErrConflictingContentLength,
+		"POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello!": ErrConflictingContentLength,
+		"POST / HTTP/1.1\r\nContent-Length: 5, 5\r\n\r\nhello":                    ErrConflictingContentLength,
+		"POST / HTTP/1.1\r\nContent-Length: +5\r\n\r\nhello":                      ErrInvalidContentLength,
+		"POST / HTTP/1.1\r\nContent-Length: 0x5\r\n\r\nhello":                     ErrInvalidContentLength,
+		"POST / HTTP/1.1\r\nContent-Length: \r\n\r\nhello":                        ErrInvalidContentLength,
+		"POST / HTTP/1.1\r\nContent-Length: ,\r\n\r\nhello":                       ErrInvalidContentLength,
+		// Content-Length together with Transfer-Encoding
+		"POST / HTTP/1.1\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n": ErrAmbiguousFraming,
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked, identity\r\n\r\n":                     ErrAmbiguousFraming,
+		"POST / HTTP/1.1\r\nTransfer-Encoding: \r\nContent-Length: 5\r\n\r\nhello":            ErrAmbiguousFraming,
+		"POST / HTTP/1.1\r\nTransfer-Encoding: \r\n\r\nhello":                                 ErrAmbiguousFraming,
+		"POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n":                         ErrUnsupportedTransferEncoding,
+		"POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n":                      ErrAmbiguousFraming,
+		// obs-fold, whitespace before the colon, bare LF
+		"GET / HTTP/1.1\r\nX-Folded: a\r\n b\r\n\r\n": ErrMalformedHeader,
+		"GET / HTTP/1.1\r\nHost : localhost\r\n\r\n":  ErrMalformedHeader,
+		"GET / HTTP/1.1\r\nHost: localhost\n\r\n":     ErrMalformedHeader,
+		"GET / HTTP/1.1\nHost: localhost\r\n\r\n":     ErrMalformedRequestLine,
+		"GET / HTTP/1.1\r\nHost: local\rhost\r\n\r\n": ErrMalformedHeader,
+		// invalid characters in the request line
+		"G(T / HTTP/1.1\r\n\r\n":            ErrMalformedRequestLine,
+		"GET /a\x00b HTTP/1.1\r\n\r\n":      ErrMalformedRequestLine,
+		"GET /caf\xc3\xa9 HTTP/1.1\r\n\r\n": ErrMalformedRequestLine,
+		"GET  / HTTP/1.1\r\n\r\n":           ErrMalformedRequestLine,
+		"GET /\t HTTP/1.1\r\n\r\n":          ErrMalformedRequestLine,
+	}
+	for data, want := range rejected {
+		_, err := RequestFromReader(strings.NewReader(data))
+		require.ErrorIs(t, err, want, "%q", data)
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr)
+	}
+
+	// Test: A stray CRLF before the request line is fine
+	r, err := RequestFromReader(strings.NewReader("\r\nGET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+}
+
+func TestSmugglingLenient(t *testing.T) {
+	parse := func(data string) (*Request, error) {
+		p := NewParser(strings.NewReader(data), DefaultLimits)
+		p.Lenient = true
+		r, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, err = r.ReadBody()
+		return r, err
+	}
+
+	// Test: Identical Content-Length values are merged, different ones aren't
+	r, err := parse("POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	_, err = parse("POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello!")
+	require.ErrorIs(t, err, ErrConflictingContentLength)
+
+	// Test: Transfer-Encoding wins over Content-Length and the connection closes
+	r, err = parse("POST / HTTP/1.1\r\nContent-Length: 100\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	assert.Equal(t, "", r.Headers.Get("Content-Length"))
+	assert.False(t, r.KeepAlive())
+
+	// Test: obs-fold is unfolded and bare LF accepted
+	r, err = parse("GET / HTTP/1.1\nX-Folded: first\n   second\r\n\tthird\nHost: localhost\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, "first second third", r.Headers.Get("X-Folded"))
+	assert.Equal(t, "localhost", r.Headers.Get("Host"))
+
+	// Test: Still no unknown codings or whitespace before the colon
+	_, err = parse("POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n")
+	require.ErrorIs(t, err, ErrUnsupportedTransferEncoding)
+	_, err = parse("GET / HTTP/1.1\r\nHost : localhost\r\n\r\n")
+	require.ErrorIs(t, err, ErrMalformedHeader)
+}
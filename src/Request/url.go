@@ -0,0 +1,295 @@
+package request
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TargetForm is one of the four request-target forms from RFC 9112 section 3.2
+type TargetForm int
+
+const (
+	OriginForm    TargetForm = iota // /path?query
+	AbsoluteForm                    // http://host/path?query
+	AuthorityForm                   // host:port, CONNECT only
+	AsteriskForm                    // *, OPTIONS only
+)
+
+// URL is the parsed request target. Path is percent-decoded and normalized,
+// so "/a/./b/../../etc//passwd" comes out as "/etc/passwd".
+type URL struct {
+	Form     TargetForm
+	Scheme   string
+	Host     string
+	Path     string
+	RawPath  string
+	RawQuery string
+	Query    Values
+}
+
+var (
+	ErrMalformedRequestTarget = fmt.Errorf("Malformed request target")
+	ErrInvalidEscape          = fmt.Errorf("Invalid percent-encoding")
+)
+
+// Values holds decoded query parameters in the order they were sent.
+type Values map[string][]string
+
+func (v Values) Get(key string) string {
+	vals := v[key]
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
+
+func (v Values) Add(key, value string) {
+	v[key] = append(v[key], value)
+}
+
+func (v Values) Set(key, value string) {
+	v[key] = []string{value}
+}
+
+func (v Values) Del(key string) {
+	delete(v, key)
+}
+
+func (v Values) Has(key string) bool {
+	_, ok := v[key]
+	return ok
+}
+
+// ParseQuery decodes a query string like "a=1&b=two+words&a=3".
+func ParseQuery(query string) (Values, error) {
+	values := Values{}
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		key, err := unescape(key, true)
+		if err != nil {
+			return nil, err
+		}
+		value, err = unescape(value, true)
+		if err != nil {
+			return nil, err
+		}
+		values.Add(key, value)
+	}
+	return values, nil
+}
+
+// ParseRequestTarget parses the target from the request line. The method is
+// needed because authority-form is only valid for CONNECT and asterisk-form
+// only for OPTIONS.
+func ParseRequestTarget(method, target string) (*URL, error) {
+	if target == "" || strings.ContainsAny(target, "# \t\r\n") {
+		return nil, ErrMalformedRequestTarget
+	}
+
+	u := &URL{}
+	switch {
+	case target == "*":
+		if method != "OPTIONS" {
+			return nil, ErrMalformedRequestTarget
+		}
+		u.Form = AsteriskForm
+		u.Path = "*"
+		u.RawPath = "*"
+		u.Query = Values{}
+		return u, nil
+
+	case method == "CONNECT":
+		if !isValidAuthority(target) || !strings.Contains(target, ":") {
+			return nil, ErrMalformedRequestTarget
+		}
+		u.Form = AuthorityForm
+		u.Host = target
+		u.Query = Values{}
+		return u, nil
+
+	case strings.HasPrefix(target, "/"):
+		u.Form = OriginForm
+
+	default:
+		scheme, rest, ok := strings.Cut(target, "://")
+		if !ok || !isValidScheme(scheme) {
+			return nil, ErrMalformedRequestTarget
+		}
+		authority := rest
+		if idx := strings.IndexAny(rest, "/?"); idx != -1 {
+			authority = rest[:idx]
+			rest = rest[idx:]
+		} else {
+			rest = ""
+		}
+		if !isValidAuthority(authority) {
+			return nil, ErrMalformedRequestTarget
+		}
+		u.Form = AbsoluteForm
+		u.Scheme = strings.ToLower(scheme)
+		u.Host = authority
+		target = rest
+		if !strings.HasPrefix(target, "/") {
+			target = "/" + target
+		}
+	}
+
+	rawPath, rawQuery, _ := strings.Cut(target, "?")
+	path, err := unescape(rawPath, false)
+	if err != nil {
+		return nil, err
+	}
+	query, err := ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	u.RawPath = rawPath
+	u.Path = cleanPath(path)
+	u.RawQuery = rawQuery
+	u.Query = query
+	return u, nil
+}
+
+// RequestURI is the target as it should appear on a request line.
+func (u *URL) RequestURI() string {
+	switch u.Form {
+	case AsteriskForm:
+		return "*"
+	case AuthorityForm:
+		return u.Host
+	}
+	uri := escapePath(u.Path)
+	if u.RawQuery != "" {
+		uri += "?" + u.RawQuery
+	}
+	return uri
+}
+
+func (u *URL) String() string {
+	if u.Form == AbsoluteForm {
+		return u.Scheme + "://" + u.Host + u.RequestURI()
+	}
+	return u.RequestURI()
+}
+
+// cleanPath removes dot-segments (RFC 3986 section 5.2.4) and collapses
+// repeated slashes. ".." never climbs above the root.
+func cleanPath(path string) string {
+	trailingSlash := strings.HasSuffix(path, "/") ||
+		strings.HasSuffix(path, "/.") || strings.HasSuffix(path, "/..")
+
+	segments := []string{}
+	for _, seg := range strings.Split(path, "/") {
+		switch seg {
+		case "", ".":
+			continue
+		case "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+		default:
+			segments = append(segments, seg)
+		}
+	}
+
+	cleaned := "/" + strings.Join(segments, "/")
+	if trailingSlash && len(segments) > 0 {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// unescape decodes %XX sequences, and '+' as space when decoding a query.
+// NUL is rejected since nothing downstream expects it inside a path or value.
+func unescape(s string, query bool) (string, error) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return "", ErrInvalidEscape
+			}
+			b := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if b == 0 {
+				return "", ErrInvalidEscape
+			}
+			sb.WriteByte(b)
+			i += 2
+		case ch == '+' && query:
+			sb.WriteByte(' ')
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String(), nil
+}
+
+func escapePath(path string) string {
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		ch := path[i]
+		if isUnreserved(ch) || strings.IndexByte("/:@!$&'()*+,;=", ch) != -1 {
+			sb.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", ch)
+	}
+	return sb.String()
+}
+
+func isValidScheme(scheme string) bool {
+	if scheme == "" || !isAlpha(scheme[0]) {
+		return false
+	}
+	for i := 1; i < len(scheme); i++ {
+		ch := scheme[i]
+		if !isAlpha(ch) && !(ch >= '0' && ch <= '9') && ch != '+' && ch != '-' && ch != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidAuthority accepts host[:port], userinfo is not allowed in http URIs
+func isValidAuthority(authority string) bool {
+	if authority == "" || strings.Contains(authority, "@") {
+		return false
+	}
+	for i := 0; i < len(authority); i++ {
+		ch := authority[i]
+		if isUnreserved(ch) || strings.IndexByte(":[]!$&'()*+,;=%", ch) != -1 {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func isUnreserved(ch byte) bool {
+	return isAlpha(ch) || (ch >= '0' && ch <= '9') || ch == '-' || ch == '.' || ch == '_' || ch == '~'
+}
+
+func isAlpha(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isHex(ch byte) bool {
+	return (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+func unhex(ch byte) byte {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return ch - '0'
+	case ch >= 'a' && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
@@ -0,0 +1,152 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+// NewRequest builds an HTTP/1.1 request for Write. target is an absolute
+// http or https URL and body may be nil. Host is set from the target, and
+// so is Content-Length when body is a bytes.Buffer, bytes.Reader or
+// strings.Reader. Any other body is sent chunked.
+func NewRequest(method, target string, body io.Reader) (*Request, error) {
+	if !headers.IsValidToken(method) {
+		return nil, fmt.Errorf("%w : method %q", ErrMalformedRequestLine, method)
+	}
+	u, err := ParseRequestTarget(method, target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Form != AbsoluteForm || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("%w : %s is not an http or https URL", ErrMalformedRequestTarget, target)
+	}
+
+	r := newRequest(DefaultLimits)
+	r.URL = u
+	r.RequestLine = RequestLine{
+		Method:        method,
+		RequestTarget: originForm(u),
+		HttpVersion:   "HTTP/1.1",
+	}
+	r.Headers.Set("Host", u.Host)
+	if body != nil {
+		switch b := body.(type) {
+		case *bytes.Buffer:
+			r.Headers.SetContentLength(int64(b.Len()))
+		case *bytes.Reader:
+			r.Headers.SetContentLength(int64(b.Len()))
+		case *strings.Reader:
+			r.Headers.SetContentLength(int64(b.Len()))
+		}
+		rc, ok := body.(io.ReadCloser)
+		if !ok {
+			rc = io.NopCloser(body)
+		}
+		r.BodyReader = rc
+	}
+	r.state = StateDone
+	return r, nil
+}
+
+// originForm is the target as sent on the request line, the path as the
+// caller escaped it rather than the normalized one
+func originForm(u *URL) string {
+	target := u.RawPath
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	return target
+}
+
+// Write sends the request line, headers and body. A body without
+// Content-Length goes out chunked with Trailers after it, and a POST, PUT
+// or PATCH without any body says "Content-Length: 0".
+func (r *Request) Write(w io.Writer) error {
+	if err := r.Headers.Validate(); err != nil {
+		return err
+	}
+	rl := r.RequestLine
+	if !headers.IsValidToken(rl.Method) || rl.RequestTarget == "" || strings.ContainsAny(rl.RequestTarget, " \t\r\n") {
+		return fmt.Errorf("%w : %s %s", ErrMalformedRequestLine, rl.Method, rl.RequestTarget)
+	}
+	version := rl.HttpVersion
+	if version == "" {
+		version = "HTTP/1.1"
+	}
+
+	length, err := r.Headers.ContentLength()
+	if err != nil {
+		return fmt.Errorf("%w : %w", ErrInvalidContentLength, err)
+	}
+	chunked := false
+	switch {
+	case r.BodyReader != nil && length < 0:
+		if version == "HTTP/1.0" {
+			return fmt.Errorf("%w : HTTP/1.0 body without Content-Length", ErrUnsupportedTransferEncoding)
+		}
+		r.Headers.Set("Transfer-Encoding", "chunked")
+		chunked = true
+	case r.BodyReader == nil && length < 0:
+		switch rl.Method {
+		case "POST", "PUT", "PATCH":
+			r.Headers.SetContentLength(0)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s %s %s\r\n", rl.Method, rl.RequestTarget, version)
+	r.Headers.ForEach(func(key, value string) {
+		fmt.Fprintf(bw, "%s: %s\r\n", key, value)
+	})
+	bw.WriteString("\r\n")
+
+	switch {
+	case r.BodyReader == nil:
+	case chunked:
+		if err := r.writeChunked(bw); err != nil {
+			return err
+		}
+	default:
+		n, err := io.CopyN(bw, r.BodyReader, length)
+		if err != nil {
+			return fmt.Errorf("%w : body ended after %d of %d bytes", ErrInvalidContentLength, n, length)
+		}
+	}
+	return bw.Flush()
+}
+
+// writeChunked frames the body as one chunk per read, then the trailers
+func (r *Request) writeChunked(bw *bufio.Writer) error {
+	if err := r.Trailers.Validate(); err != nil {
+		return err
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.BodyReader.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(bw, "%x\r\n", n)
+			bw.Write(buf[:n])
+			bw.WriteString("\r\n")
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	bw.WriteString("0\r\n")
+	r.Trailers.ForEach(func(key, value string) {
+		fmt.Fprintf(bw, "%s: %s\r\n", key, value)
+	})
+	_, err := bw.WriteString("\r\n")
+	return err
+}
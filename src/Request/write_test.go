@@ -0,0 +1,77 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRequest(t *testing.T) {
+	r, err := NewRequest("GET", "http://example.com:8080/a%20b/../c?x=1&y=2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/a%20b/../c?x=1&y=2", r.RequestLine.RequestTarget)
+	assert.Equal(t, "example.com:8080", r.Headers.Get("Host"))
+	assert.Equal(t, "http", r.URL.Scheme)
+
+	r, err = NewRequest("GET", "https://example.com", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/", r.RequestLine.RequestTarget)
+
+	for _, target := range []string{"/relative", "ftp://example.com/", "http://exa mple.com/"} {
+		_, err = NewRequest("GET", target, nil)
+		require.ErrorIs(t, err, ErrMalformedRequestTarget, target)
+	}
+	_, err = NewRequest("GE T", "http://example.com/", nil)
+	require.ErrorIs(t, err, ErrMalformedRequestLine)
+}
+
+func TestWriteRequest(t *testing.T) {
+	// Test: A body of known length goes out with Content-Length and parses
+	// back the same
+	r, err := NewRequest("POST", "http://localhost:42069/submit", strings.NewReader("hello"))
+	require.NoError(t, err)
+	r.Headers.Set("Content-Type", "text/plain")
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+	assert.Equal(t, "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\nhello", buf.String())
+	parsed, err := RequestFromReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(parsed.Body))
+
+	// Test: Any other reader is sent chunked, trailers included
+	r, err = NewRequest("PUT", "http://localhost/upload", iotest.HalfReader(strings.NewReader("streamed body")))
+	require.NoError(t, err)
+	r.Trailers.Set("X-Checksum", "abc")
+	buf.Reset()
+	require.NoError(t, r.Write(&buf))
+	assert.Contains(t, buf.String(), "Transfer-Encoding: chunked\r\n")
+	parsed, err = RequestFromReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "streamed body", string(parsed.Body))
+	assert.Equal(t, "abc", parsed.Trailers.Get("X-Checksum"))
+
+	// Test: POST without a body says so
+	r, err = NewRequest("POST", "http://localhost/", nil)
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, r.Write(&buf))
+	assert.Equal(t, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\n\r\n", buf.String())
+
+	// Test: A body shorter than its Content-Length, and header injection
+	r, err = NewRequest("POST", "http://localhost/", io.LimitReader(strings.NewReader("hello"), 3))
+	require.NoError(t, err)
+	r.Headers.SetContentLength(5)
+	require.ErrorIs(t, r.Write(io.Discard), ErrInvalidContentLength)
+
+	r, err = NewRequest("GET", "http://localhost/", nil)
+	require.NoError(t, err)
+	r.Headers.Set("X-Evil", "a\r\nInjected: yes")
+	buf.Reset()
+	require.Error(t, r.Write(&buf))
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,289 @@
+// Package client is an HTTP/1.1 client on top of the project's own request
+// serializer and response parser, with keep-alive connections pooled per
+// host.
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	request "github/gojogourav/http-from-scratch/Request"
+	"github/gojogourav/http-from-scratch/internals/response"
+)
+
+var ErrUnsupportedScheme = fmt.Errorf("Unsupported URL scheme")
+
+// Client sends requests and pools the connections it can reuse. It's safe
+// for concurrent use, a zero Client works with no timeouts and no pooling
+// limits besides the defaults below.
+type Client struct {
+	// DialTimeout bounds connecting, TLS handshake included
+	DialTimeout time.Duration
+	// WriteTimeout bounds sending the whole request
+	WriteTimeout time.Duration
+	// ReadTimeout is how long the server may go without sending anything,
+	// it's reset by every read so a slow stream can go on indefinitely
+	ReadTimeout time.Duration
+	// IdleTimeout is how long an unused connection stays in the pool
+	IdleTimeout time.Duration
+	// MaxIdlePerHost caps the pooled connections per host, zero means
+	// DefaultMaxIdlePerHost
+	MaxIdlePerHost int
+	// TLSConfig for https, ServerName is filled in from the URL when empty
+	TLSConfig *tls.Config
+
+	mu   sync.Mutex
+	idle map[string][]*conn
+}
+
+const DefaultMaxIdlePerHost = 2
+
+// DefaultClient is what Get uses
+var DefaultClient = &Client{
+	DialTimeout:  10 * time.Second,
+	WriteTimeout: 30 * time.Second,
+	ReadTimeout:  30 * time.Second,
+	IdleTimeout:  90 * time.Second,
+}
+
+// Get fetches url with DefaultClient
+func Get(url string) (*response.Response, error) {
+	return DefaultClient.Get(url)
+}
+
+func (c *Client) Get(url string) (*response.Response, error) {
+	req, err := request.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req and returns the response as soon as its headers are in. The
+// body streams from BodyReader, which has to be read to EOF or closed: at
+// EOF the connection goes back to the pool, closing it early drops the
+// connection.
+func (c *Client) Do(req *request.Request) (*response.Response, error) {
+	if req.URL == nil {
+		return nil, fmt.Errorf("%w : request has no URL", request.ErrMalformedRequestTarget)
+	}
+	key, err := hostKey(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		cn, reused, err := c.getConn(key, req.URL)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.roundTrip(cn, req)
+		if err == nil {
+			return resp, nil
+		}
+		cn.Close()
+		// the server may have dropped a pooled connection just as we picked
+		// it, try a fresh one if the request can be sent again
+		if !reused || req.BodyReader != nil || !staleConnError(err) {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) roundTrip(cn *conn, req *request.Request) (*response.Response, error) {
+	if c.WriteTimeout > 0 {
+		cn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
+	}
+	if err := req.Write(cn); err != nil {
+		return nil, err
+	}
+	cn.SetWriteDeadline(time.Time{})
+
+	resp, err := response.ReadResponse(cn.br, req.RequestLine.Method)
+	if err != nil {
+		return nil, err
+	}
+	keepAlive := resp.KeepAlive() && !req.Headers.HasToken("Connection", "close")
+	if resp.ContentLength == 0 {
+		// nothing left on the connection for this response
+		c.release(cn, keepAlive)
+		return resp, nil
+	}
+	resp.BodyReader = &body{ReadCloser: resp.BodyReader, client: c, conn: cn, keepAlive: keepAlive}
+	return resp, nil
+}
+
+// staleConnError is what a reused connection the server already closed
+// looks like
+func staleConnError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// hostKey is scheme and host:port, connections are only shared within one
+func hostKey(u *request.URL) (string, error) {
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("%w : %q", ErrUnsupportedScheme, u.Scheme)
+	}
+	return u.Scheme + "://" + hostPort(u), nil
+}
+
+// hostPort adds the scheme's default port when the URL has none
+func hostPort(u *request.URL) string {
+	if _, _, err := net.SplitHostPort(u.Host); err == nil {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(strings.Trim(u.Host, "[]"), "443")
+	}
+	return net.JoinHostPort(strings.Trim(u.Host, "[]"), "80")
+}
+
+// getConn takes the most recently used idle connection for key or dials a
+// new one
+func (c *Client) getConn(key string, u *request.URL) (*conn, bool, error) {
+	c.mu.Lock()
+	for conns := c.idle[key]; len(conns) > 0; conns = c.idle[key] {
+		cn := conns[len(conns)-1]
+		c.idle[key] = conns[:len(conns)-1]
+		if c.IdleTimeout > 0 && time.Since(cn.idleSince) > c.IdleTimeout {
+			cn.Close()
+			continue
+		}
+		c.mu.Unlock()
+		return cn, true, nil
+	}
+	c.mu.Unlock()
+
+	cn, err := c.dial(key, u)
+	return cn, false, err
+}
+
+func (c *Client) dial(key string, u *request.URL) (*conn, error) {
+	addr := hostPort(u)
+	dialer := &net.Dialer{Timeout: c.DialTimeout}
+	var (
+		nc  net.Conn
+		err error
+	)
+	if u.Scheme == "https" {
+		cfg := &tls.Config{}
+		if c.TLSConfig != nil {
+			cfg = c.TLSConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			host, _, _ := net.SplitHostPort(addr)
+			cfg.ServerName = host
+		}
+		// only HTTP/1.1 is spoken here
+		cfg.NextProtos = []string{"http/1.1"}
+		nc, err = tls.DialWithDialer(dialer, "tcp", addr, cfg)
+	} else {
+		nc, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, key: key, readTimeout: c.ReadTimeout}
+	cn.br = bufio.NewReader(cn)
+	return cn, nil
+}
+
+// release puts cn back in the pool, or closes it when it can't be reused
+// or the pool is full
+func (c *Client) release(cn *conn, keepAlive bool) {
+	if !keepAlive || cn.br.Buffered() > 0 {
+		// bytes nobody asked for, the connection is out of step
+		cn.Close()
+		return
+	}
+	max := c.MaxIdlePerHost
+	if max == 0 {
+		max = DefaultMaxIdlePerHost
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.idle == nil {
+		c.idle = map[string][]*conn{}
+	}
+	if len(c.idle[cn.key]) >= max {
+		cn.Close()
+		return
+	}
+	cn.idleSince = time.Now()
+	c.idle[cn.key] = append(c.idle[cn.key], cn)
+}
+
+// CloseIdleConnections closes every pooled connection, ones in use are
+// left alone
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, conns := range c.idle {
+		for _, cn := range conns {
+			cn.Close()
+		}
+		delete(c.idle, key)
+	}
+}
+
+// conn is a pooled connection, every read pushes the read deadline out
+type conn struct {
+	net.Conn
+	br          *bufio.Reader
+	key         string
+	readTimeout time.Duration
+	idleSince   time.Time
+}
+
+func (cn *conn) Read(p []byte) (int, error) {
+	if cn.readTimeout > 0 {
+		cn.SetReadDeadline(time.Now().Add(cn.readTimeout))
+	}
+	return cn.Conn.Read(p)
+}
+
+// body hands the connection back once the response body was read to the
+// end
+type body struct {
+	io.ReadCloser
+	client    *Client
+	conn      *conn
+	keepAlive bool
+	// sticky end of the body, io.EOF or what went wrong
+	err error
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.err = err
+		if err == io.EOF {
+			b.client.release(b.conn, b.keepAlive)
+		} else {
+			b.conn.Close()
+		}
+	}
+	return n, err
+}
+
+// Close drops the connection unless the body was already read to the end
+func (b *body) Close() error {
+	if b.err != nil {
+		return nil
+	}
+	b.err = request.ErrBodyClosed
+	return b.conn.Close()
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	request "github/gojogourav/http-from-scratch/Request"
+	"github/gojogourav/http-from-scratch/internals/response"
+)
+
+// testServer answers every request on a connection with respond, until
+// respond returns false. accepted counts connections.
+type testServer struct {
+	ln       net.Listener
+	accepted atomic.Int32
+}
+
+func newTestServer(t *testing.T, respond func(conn net.Conn, r *request.Request) bool) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &testServer{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				p := request.NewParser(conn, request.DefaultLimits)
+				for {
+					r, err := p.Next()
+					if err != nil {
+						return
+					}
+					if _, err := r.ReadBody(); err != nil {
+						return
+					}
+					if !respond(conn, r) {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *testServer) url(path string) string {
+	return "http://" + s.ln.Addr().String() + path
+}
+
+func testClient() *Client {
+	return &Client{DialTimeout: time.Second, ReadTimeout: time.Second, WriteTimeout: time.Second, IdleTimeout: time.Minute}
+}
+
+func TestKeepAlive(t *testing.T) {
+	s := newTestServer(t, func(conn net.Conn, r *request.Request) bool {
+		body := "you asked for " + r.URL.Path
+		if r.URL.Path == "/chunked" {
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\none\r\n3\r\ntwo\r\n0\r\n\r\n")
+			return true
+		}
+		head := "HTTP/1.1 200 OK\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n"
+		if r.RequestLine.Method == "HEAD" {
+			body = ""
+		}
+		io.WriteString(conn, head+body)
+		return true
+	})
+	c := testClient()
+
+	// Test: Sequential requests share one connection
+	for _, path := range []string{"/a", "/chunked", "/b"} {
+		resp, err := c.Get(s.url(path))
+		require.NoError(t, err)
+		body, err := resp.ReadBody()
+		require.NoError(t, err)
+		if path == "/chunked" {
+			assert.Equal(t, "onetwo", string(body))
+		} else {
+			assert.Equal(t, "you asked for "+path, string(body))
+		}
+	}
+	assert.Equal(t, int32(1), s.accepted.Load())
+
+	// Test: A body closed before its end takes the connection with it
+	resp, err := c.Get(s.url("/c"))
+	require.NoError(t, err)
+	require.NoError(t, resp.BodyReader.Close())
+	resp, err = c.Get(s.url("/d"))
+	require.NoError(t, err)
+	_, err = resp.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), s.accepted.Load())
+
+	// Test: HEAD has no body, the connection is free right away
+	req, err := request.NewRequest("HEAD", s.url("/e"), nil)
+	require.NoError(t, err)
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), resp.ContentLength)
+	resp, err = c.Get(s.url("/f"))
+	require.NoError(t, err)
+	_, err = resp.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), s.accepted.Load())
+}
+
+func TestConnectionClose(t *testing.T) {
+	// Test: "Connection: close" isn't pooled
+	s := newTestServer(t, func(conn net.Conn, r *request.Request) bool {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 2\r\n\r\nok")
+		return false
+	})
+	c := testClient()
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(s.url("/"))
+		require.NoError(t, err)
+		_, err = resp.ReadBody()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), s.accepted.Load())
+
+	// Test: A pooled connection the server dropped is retried on a new one
+	s = newTestServer(t, func(conn net.Conn, r *request.Request) bool {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+		return false
+	})
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get(s.url("/"))
+		require.NoError(t, err)
+		body, err := resp.ReadBody()
+		require.NoError(t, err)
+		assert.Equal(t, "ok", string(body))
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int32(3), s.accepted.Load())
+}
+
+func TestStreamingAndTimeouts(t *testing.T) {
+	// Test: The body is handed over while the server is still sending
+	release := make(chan struct{})
+	s := newTestServer(t, func(conn net.Conn, r *request.Request) bool {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nfirst\r\n")
+		<-release
+		io.WriteString(conn, "6\r\nsecond\r\n0\r\n\r\n")
+		return true
+	})
+	c := testClient()
+	resp, err := c.Get(s.url("/stream"))
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, err := resp.BodyReader.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(buf[:n]))
+	close(release)
+	rest, err := io.ReadAll(resp.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(rest))
+
+	// Test: A server that goes quiet runs into ReadTimeout
+	s = newTestServer(t, func(conn net.Conn, r *request.Request) bool {
+		time.Sleep(time.Second)
+		return false
+	})
+	c.ReadTimeout = 50 * time.Millisecond
+	_, err = c.Get(s.url("/"))
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+
+	// Test: Only http and https
+	_, err = c.Get("ftp://example.com/")
+	require.Error(t, err)
+}
+
+func TestProxyHTTPinStream(t *testing.T) {
+	lines := strings.Repeat(`{"id": 0, "url": "https://httpbin.org/stream/3"}`+"\n", 3)
+	s := newTestServer(t, func(conn net.Conn, r *request.Request) bool {
+		if r.URL.Path != "/stream/3" {
+			io.WriteString(conn, "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n")
+			return true
+		}
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nTransfer-Encoding: chunked\r\n\r\n")
+		for _, line := range strings.SplitAfter(lines, "\n") {
+			if line != "" {
+				io.WriteString(conn, strconv.FormatInt(int64(len(line)), 16)+"\r\n"+line+"\r\n")
+			}
+		}
+		io.WriteString(conn, "0\r\n\r\n")
+		return true
+	})
+	old := StreamURL
+	StreamURL = s.url("/stream/%d")
+	t.Cleanup(func() { StreamURL = old })
+
+	var buf bytes.Buffer
+	w := &response.Writer{Writer: &buf}
+	require.NoError(t, ProxyHTTPinStream(w, 3))
+	resp, err := response.ResponseFromReader(&buf, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, lines, string(resp.Body))
+	sum := sha256.Sum256([]byte(lines))
+	assert.Equal(t, hex.EncodeToString(sum[:]), resp.Trailers.Get("X-Content-SHA256"))
+	assert.Equal(t, strconv.Itoa(len(lines)), resp.Trailers.Get("X-Content-Length"))
+
+	// Test: An error status isn't relayed
+	buf.Reset()
+	require.Error(t, ProxyHTTPinStream(&response.Writer{Writer: &buf}, 4))
+	assert.Empty(t, buf.String())
+
+	// Test: An upstream that drops halfway aborts the response, there's no
+	// last chunk to pass it off as complete
+	s = newTestServer(t, func(conn net.Conn, r *request.Request) bool {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nfirst\r\n")
+		return false
+	})
+	StreamURL = s.url("/stream/%d")
+	buf.Reset()
+	w = &response.Writer{Writer: &buf}
+	require.Error(t, ProxyHTTPinStream(w, 3))
+	require.ErrorIs(t, w.Finish(), response.ErrResponseAborted)
+	assert.True(t, strings.HasSuffix(buf.String(), "5\r\nfirst\r\n"))
+	_, err = response.ResponseFromReader(&buf, "GET")
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
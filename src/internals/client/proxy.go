@@ -0,0 +1,50 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+
+	headers "github/gojogourav/http-from-scratch/Headers"
+	"github/gojogourav/http-from-scratch/internals/response"
+)
+
+// StreamURL is where ProxyHTTPinStream fetches count JSON lines from
+var StreamURL = "https://httpbin.org/stream/%d"
+
+// ProxyHTTPinStream relays httpbin's stream endpoint as a chunked body,
+// with the SHA-256 and length of what was relayed as trailers. If the
+// upstream fails once the body started, the response is aborted.
+func ProxyHTTPinStream(w *response.Writer, count int) error {
+	resp, err := DefaultClient.Get(fmt.Sprintf(StreamURL, count))
+	if err != nil {
+		return fmt.Errorf("failed to fetch httpbin: %w", err)
+	}
+	defer resp.BodyReader.Close()
+	if resp.StatusCode != response.StatusOk {
+		return fmt.Errorf("httpbin answered %d %s", resp.StatusCode, resp.Reason)
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "application/json")
+	h.Set("Trailer", "X-Content-SHA256, X-Content-Length")
+	body, err := w.ChunkedBody(h)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	length, err := io.CopyBuffer(io.MultiWriter(body, hash), resp.BodyReader, make([]byte, 32))
+	if err != nil {
+		// the headers are out, all that's left is not to pass the cut off
+		// body for a whole one
+		w.Abort()
+		return fmt.Errorf("read error: %w", err)
+	}
+
+	body.Trailer.Set("X-Content-SHA256", hex.EncodeToString(hash.Sum(nil)))
+	body.Trailer.Set("X-Content-Length", strconv.FormatInt(length, 10))
+	return body.Close()
+}
@@ -0,0 +1,114 @@
+package response
+
+import (
+	"fmt"
+	"strings"
+
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+var (
+	ErrChunkedNotSupported = fmt.Errorf("HTTP/1.0 has no chunked transfer coding")
+	// ErrUndeclaredTrailer is a trailer field that wasn't named in the
+	// Trailer header, or one that can't be a trailer at all
+	ErrUndeclaredTrailer = fmt.Errorf("Trailer field not declared")
+)
+
+// ChunkedWriter is a chunked response body, every Write goes out as one
+// chunk. Fields put in Trailer are sent by Close, they have to be declared
+// in the Trailer header first.
+type ChunkedWriter struct {
+	Trailer *headers.Headers
+
+	w        *Writer
+	declared []string
+	closed   bool
+}
+
+// ChunkedBody sends h with "Transfer-Encoding: chunked" and returns the
+// body writer. A 200 goes out first if no status line was written, h may
+// be nil for the default headers.
+func (w *Writer) ChunkedBody(h *headers.Headers) (*ChunkedWriter, error) {
+	if w.HttpVersion == "HTTP/1.0" {
+		return nil, ErrChunkedNotSupported
+	}
+	if h == nil {
+		h = GetDefaultHeaders(0)
+	}
+	declared := h.Tokens("Trailer")
+	for _, name := range declared {
+		if !allowedInTrailer(name) {
+			return nil, fmt.Errorf("%w : %s can't be sent as a trailer", ErrUndeclaredTrailer, name)
+		}
+	}
+
+	if w.state == stateStatus {
+		if err := w.WriteStatusLine(StatusOk); err != nil {
+			return nil, err
+		}
+	}
+	h.Del("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	if err := w.WriteHeaders(h); err != nil {
+		return nil, err
+	}
+	return &ChunkedWriter{
+		Trailer:  headers.NewHeaders(),
+		w:        w,
+		declared: declared,
+	}, nil
+}
+
+func (cw *ChunkedWriter) Write(p []byte) (int, error) {
+	if cw.closed {
+		return 0, ErrWriteOrder
+	}
+	return cw.w.WriteBody(p)
+}
+
+// Close writes the last chunk and the trailer section. Nothing is sent if
+// Trailer holds a field that wasn't declared.
+func (cw *ChunkedWriter) Close() error {
+	if cw.closed {
+		return nil
+	}
+	var undeclared []string
+	cw.Trailer.ForEach(func(key, value string) {
+		if !cw.isDeclared(key) {
+			undeclared = append(undeclared, key)
+		}
+	})
+	if len(undeclared) > 0 {
+		return fmt.Errorf("%w : %s", ErrUndeclaredTrailer, strings.Join(undeclared, ", "))
+	}
+	cw.closed = true
+	return cw.w.WriteTrailers(cw.Trailer)
+}
+
+func (cw *ChunkedWriter) isDeclared(name string) bool {
+	for _, d := range cw.declared {
+		if strings.EqualFold(d, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedInTrailer rules out the fields a recipient needs before the body,
+// RFC 9110 section 6.5.1
+func allowedInTrailer(name string) bool {
+	switch strings.ToLower(name) {
+	case "transfer-encoding", "content-length", "content-encoding", "content-type",
+		"content-range", "trailer", "host", "connection", "te", "expect",
+		"cache-control", "authorization", "set-cookie":
+		return false
+	}
+	return true
+}
+
+// appendChunk frames p as one chunk
+func appendChunk(dst, p []byte) []byte {
+	dst = fmt.Appendf(dst, "%x\r\n", len(p))
+	dst = append(dst, p...)
+	return append(dst, "\r\n"...)
+}
@@ -0,0 +1,153 @@
+package response
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"strconv"
+	"strings"
+
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+// MinCompressSize is the smallest declared Content-Length worth compressing,
+// below it the coding overhead eats the gain
+const MinCompressSize = 256
+
+// supportedEncodings in order of preference when the client likes them
+// equally
+var supportedEncodings = []string{"gzip", "deflate"}
+
+// NegotiateEncoding picks the content coding for a response from an
+// Accept-Encoding value (RFC 9110 section 12.5.3), "" means identity. The
+// highest q-value wins, "*" stands for any coding not listed and q=0 rules
+// a coding out.
+func NegotiateEncoding(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return ""
+	}
+	weights := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if !strings.EqualFold(strings.TrimSpace(key), "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+		weights[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range supportedEncodings {
+		q, ok := weights[coding]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether content of mediaType gets smaller when
+// compressed, images other than SVG, audio, video and archives already are
+func compressible(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml",
+		"application/x-javascript", "application/wasm", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// negotiateEncoding sets up compression of the body for the final headers
+// h. Once the client sent Accept-Encoding a compressible response varies on
+// it, whether or not it ends up compressed. Without the field nothing
+// changes, an identity response is fine for any cache to hand out.
+func (w *Writer) negotiateEncoding(h *headers.Headers) {
+	w.encoder = nil
+	if w.AcceptEncoding == "" || !w.status.BodyAllowed() || w.status == StatusPartialContent {
+		return
+	}
+	if h.Has("Content-Encoding") || (w.Headers != nil && w.Headers.Has("Content-Encoding")) {
+		return
+	}
+	contentType := h.Get("Content-Type")
+	if contentType == "" && w.Headers != nil {
+		contentType = w.Headers.Get("Content-Type")
+	}
+	mediaType, _, err := headers.ParseMediaType(contentType)
+	if err != nil || !compressible(mediaType) {
+		return
+	}
+	h.AddToken("Vary", "Accept-Encoding")
+	if w.contentLength >= 0 && w.contentLength < MinCompressSize {
+		return
+	}
+	if w.Head {
+		// there's no body to tell the coded length from, the declared one
+		// is better than the length of an empty gzip stream
+		return
+	}
+
+	coding := NegotiateEncoding(w.AcceptEncoding)
+	body := framedWriter{w}
+	switch coding {
+	case "gzip":
+		w.encoder = gzip.NewWriter(body)
+	case "deflate":
+		// "deflate" is the zlib format, RFC 9110 section 8.4.1.2
+		w.encoder = zlib.NewWriter(body)
+	default:
+		return
+	}
+	h.Set("Content-Encoding", coding)
+	// the length is of the coded body now, Finish fills it in if it fits
+	// the buffer
+	h.Del("Content-Length")
+}
+
+// closeEncoder writes the end of the compressed stream, later body bytes
+// go out as they are (there shouldn't be any)
+func (w *Writer) closeEncoder() error {
+	if w.encoder == nil {
+		return nil
+	}
+	enc := w.encoder
+	w.encoder = nil
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("closing the content coding : %w", err)
+	}
+	return nil
+}
+
+// framedWriter is where the encoder's output goes, straight to the body
+// framing without being counted against the declared length again
+type framedWriter struct {
+	w *Writer
+}
+
+func (f framedWriter) Write(p []byte) (int, error) {
+	return f.w.writeFramed(p)
+}
@@ -0,0 +1,195 @@
+package response
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+// splitResponse cuts a written response into its head, every line ending
+// in CRLF, and its body, a chunked body is decoded
+func splitResponse(t *testing.T, raw string) (string, []byte) {
+	head, body, ok := strings.Cut(raw, "\r\n\r\n")
+	require.True(t, ok, "no end of headers in %q", raw)
+	head += "\r\n"
+	if !strings.Contains(head, "Transfer-Encoding: chunked") {
+		return head, []byte(body)
+	}
+	var out []byte
+	for {
+		line, rest, ok := strings.Cut(body, "\r\n")
+		require.True(t, ok, "truncated chunk")
+		size, err := strconv.ParseInt(line, 16, 64)
+		require.NoError(t, err)
+		if size == 0 {
+			return head, out
+		}
+		out = append(out, rest[:size]...)
+		body = rest[size+2:]
+	}
+}
+
+func gunzip(t *testing.T, b []byte) string {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                           "",
+		"gzip":                       "gzip",
+		"deflate, gzip":              "gzip",
+		"gzip;q=0.5, deflate":        "deflate",
+		"gzip;q=0, deflate;q=0":      "",
+		"br":                         "",
+		"*":                          "gzip",
+		"*;q=0.1, gzip;q=0":          "deflate",
+		"identity":                   "",
+		"GZIP;Q=0.8":                 "gzip",
+		"x-gzip":                     "gzip",
+		"gzip;q=bogus, deflate;q=.2": "deflate",
+	} {
+		assert.Equal(t, want, NegotiateEncoding(accept), accept)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	page := strings.Repeat("<p>hello compression</p>\n", 40)
+
+	// Test: A buffered body is compressed and sent with the coded length
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf, AcceptEncoding: "gzip, deflate"}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	require.NoError(t, w.WriteHeaders(h))
+	io.WriteString(w, page)
+	require.NoError(t, w.Finish())
+	head, body := splitResponse(t, buf.String())
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	assert.Contains(t, head, "Vary: Accept-Encoding\r\n")
+	assert.Contains(t, head, "Content-Length: "+strconv.Itoa(len(body)))
+	assert.Less(t, len(body), len(page))
+	assert.Equal(t, page, gunzip(t, body))
+
+	// Test: A declared length is checked against what the handler wrote and
+	// replaced by the coded one
+	buf.Reset()
+	w = &Writer{Writer: &buf, AcceptEncoding: "deflate", Headers: headers.NewHeaders()}
+	w.Headers.Set("Content-Length", "999")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	h = headers.NewHeaders()
+	h.Set("Content-Type", "application/json")
+	h.SetContentLength(int64(len(page)))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := io.WriteString(w, page+"x")
+	require.ErrorIs(t, err, ErrContentLengthMismatch)
+	io.WriteString(w, page)
+	require.NoError(t, w.Finish())
+	head, body = splitResponse(t, buf.String())
+	assert.Contains(t, head, "Content-Encoding: deflate\r\n")
+	assert.NotContains(t, head, "999")
+	assert.Contains(t, head, "Content-Length: "+strconv.Itoa(len(body)))
+	r, err := zlib.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(got))
+
+	// Test: A streamed body is compressed chunk by chunk, Flush pushes out
+	// what the encoder holds
+	buf.Reset()
+	w = &Writer{Writer: &buf, AcceptEncoding: "gzip"}
+	cw, err := w.ChunkedBody(nil)
+	require.NoError(t, err)
+	io.WriteString(cw, "first ")
+	require.NoError(t, w.Flush())
+	flushed := buf.Len()
+	io.WriteString(cw, "second")
+	require.NoError(t, cw.Close())
+	assert.Greater(t, buf.Len(), flushed)
+	head, body = splitResponse(t, buf.String())
+	assert.Contains(t, head, "Transfer-Encoding: chunked\r\n")
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	assert.NotContains(t, head, "Content-Length")
+	assert.Equal(t, "first second", gunzip(t, body))
+
+	// Test: Past the buffer size a compressed body goes out chunked
+	buf.Reset()
+	w = &Writer{Writer: &buf, AcceptEncoding: "gzip", BufferSize: 16}
+	for i := 0; i < 20; i++ {
+		io.WriteString(w, page)
+	}
+	require.NoError(t, w.Finish())
+	head, body = splitResponse(t, buf.String())
+	assert.Contains(t, head, "Transfer-Encoding: chunked\r\n")
+	assert.Equal(t, strings.Repeat(page, 20), gunzip(t, body))
+}
+
+func TestCompressionSkipped(t *testing.T) {
+	page := strings.Repeat("a", 1000)
+	for name, tc := range map[string]struct {
+		accept      string
+		contentType string
+		length      int
+		vary        bool
+	}{
+		"no Accept-Encoding": {"", "text/plain", -1, false},
+		"identity only":      {"identity, gzip;q=0", "text/plain", -1, true},
+		"video":              {"gzip", "video/mp4", -1, false},
+		"png":                {"gzip", "image/png", -1, false},
+		"tiny body":          {"gzip", "text/plain", 10, true},
+	} {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf, AcceptEncoding: tc.accept}
+		require.NoError(t, w.WriteStatusLine(StatusOk), name)
+		h := headers.NewHeaders()
+		h.Set("Content-Type", tc.contentType)
+		body := page
+		if tc.length >= 0 {
+			body = page[:tc.length]
+			h.SetContentLength(int64(tc.length))
+		}
+		require.NoError(t, w.WriteHeaders(h), name)
+		io.WriteString(w, body)
+		require.NoError(t, w.Finish(), name)
+		head, got := splitResponse(t, buf.String())
+		assert.NotContains(t, head, "Content-Encoding", name)
+		assert.Equal(t, tc.vary, strings.Contains(head, "Vary: Accept-Encoding"), name)
+		assert.Equal(t, body, string(got), name)
+	}
+
+	// Test: A body the handler already coded is left alone
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf, AcceptEncoding: "gzip"}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Set("Content-Encoding", "br")
+	require.NoError(t, w.WriteHeaders(h))
+	io.WriteString(w, page)
+	require.NoError(t, w.Finish())
+	_, got := splitResponse(t, buf.String())
+	assert.Equal(t, page, string(got))
+
+	// Test: Nor is a 304, which has no body to code
+	buf.Reset()
+	w = &Writer{Writer: &buf, AcceptEncoding: "gzip"}
+	require.NoError(t, w.WriteStatusLine(StatusNotModified))
+	h = headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+}
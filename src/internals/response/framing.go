@@ -0,0 +1,57 @@
+package response
+
+// DefaultBufferSize is how much of a response body is buffered to give it
+// a Content-Length
+const DefaultBufferSize = 4096
+
+func (w *Writer) bufferSize() int {
+	if w.BufferSize == 0 {
+		return DefaultBufferSize
+	}
+	return w.BufferSize
+}
+
+// Flush sends whatever is buffered. A body still waiting for its length
+// goes out chunked from here on, or on HTTP/1.0 until the connection closes.
+// An underlying io.Writer with a Flush method, like a bufio.Writer, is
+// flushed too.
+func (w *Writer) Flush() error {
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	if w.pending != nil {
+		if err := w.stream(); err != nil {
+			return err
+		}
+	}
+	if f, ok := w.Writer.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// stream gives up on a Content-Length for the pending headers and sends
+// them with streaming framing, followed by the buffered body
+func (w *Writer) stream() error {
+	if w.HttpVersion == "HTTP/1.0" {
+		// no chunked in HTTP/1.0, the body ends with the connection
+		w.pending.Set("Connection", "close")
+	} else {
+		w.pending.Set("Transfer-Encoding", "chunked")
+		w.chunked = true
+	}
+	return w.sendBuffered()
+}
+
+// sendBuffered writes the pending headers and the body held back so far
+func (w *Writer) sendBuffered() error {
+	h, buf := w.pending, w.buf
+	w.pending, w.buf = nil, nil
+	if err := w.sendHeaders(h); err != nil {
+		return err
+	}
+	_, err := w.writeFramed(buf)
+	return err
+}
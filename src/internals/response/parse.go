@@ -0,0 +1,416 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+var (
+	ErrMalformedStatusLine    = fmt.Errorf("Malformed status line")
+	ErrMalformedHeader        = fmt.Errorf("Malformed response header")
+	ErrInvalidContentLength   = fmt.Errorf("Invalid Content-Length value")
+	ErrMalformedChunk         = fmt.Errorf("Malformed chunked encoding")
+	ErrUnsupportedHTTPVersion = fmt.Errorf("Unsupported HTTP version")
+	ErrHeadersTooLarge        = fmt.Errorf("Response header fields too large")
+)
+
+const (
+	// maxStatusLine bounds the status line, reason phrase included
+	maxStatusLine = 8 * 1024
+	// maxResponseHeaderBytes bounds the header section, and the trailers
+	maxResponseHeaderBytes = 64 * 1024
+	// maxChunkSizeLine is a few hex digits, the rest is extensions we ignore
+	maxChunkSizeLine = 4096
+	// maxInterimResponses is how many 1xx we skip before giving up
+	maxInterimResponses = 10
+)
+
+// Response is a parsed response. BodyReader streams the body off the
+// connection, Body is only filled once it was read whole by
+// ResponseFromReader or ReadBody.
+type Response struct {
+	HttpVersion string
+	StatusCode  StatusCode
+	Reason      string
+	Headers     headers.Headers
+	// Trailers are filled once a chunked body was read to the end
+	Trailers headers.Headers
+
+	BodyReader io.ReadCloser
+	Body       []byte
+	// ContentLength of the body, -1 when it's chunked or runs until the
+	// connection closes
+	ContentLength int64
+
+	bodyBuffered bool
+	// the body ends with the connection or the framing was dubious
+	closeAfter bool
+}
+
+// ResponseFromReader parses a whole response, body included, into memory.
+// method is the request's, a response to HEAD never has a body.
+func ResponseFromReader(reader io.Reader, method string) (*Response, error) {
+	resp, err := ReadResponse(bufio.NewReader(reader), method)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resp.ReadBody(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ReadResponse parses the status line and headers from r and leaves the
+// body to BodyReader. Interim 1xx responses are skipped, except 101 which
+// ends the HTTP exchange. Once the body was read to EOF, r is at the start
+// of the next response if KeepAlive allows one.
+func ReadResponse(r *bufio.Reader, method string) (*Response, error) {
+	for i := 0; ; i++ {
+		resp, err := readHead(r)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode.Informational() && resp.StatusCode != StatusSwitchingProtocols {
+			if i == maxInterimResponses {
+				return nil, fmt.Errorf("%w : more than %d interim responses", ErrMalformedStatusLine, maxInterimResponses)
+			}
+			continue
+		}
+		if err := resp.startBody(r, method); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// ReadBody reads whatever is left of the body into Response.Body.
+// It's safe to call more than once.
+func (resp *Response) ReadBody() ([]byte, error) {
+	if resp.bodyBuffered {
+		return resp.Body, nil
+	}
+	body, err := io.ReadAll(resp.BodyReader)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = body
+	resp.bodyBuffered = true
+	resp.BodyReader = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// KeepAlive reports whether the connection can carry another request once
+// the body was read. HTTP/1.1 is persistent unless the server says
+// "Connection: close", HTTP/1.0 only with "Connection: keep-alive".
+func (resp *Response) KeepAlive() bool {
+	if resp.closeAfter || resp.Headers.HasToken("Connection", "close") {
+		return false
+	}
+	if resp.HttpVersion == "HTTP/1.0" {
+		return resp.Headers.HasToken("Connection", "keep-alive")
+	}
+	return true
+}
+
+func readHead(r *bufio.Reader) (*Response, error) {
+	line, err := readLine(r, maxStatusLine, ErrMalformedStatusLine)
+	if err != nil {
+		return nil, err
+	}
+	resp := &Response{
+		Headers:       *headers.NewHeaders(),
+		Trailers:      *headers.NewHeaders(),
+		ContentLength: -1,
+	}
+	if err := resp.parseStatusLine(line); err != nil {
+		return nil, err
+	}
+	if err := readFields(r, &resp.Headers); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// parseStatusLine reads HTTP-version SP 3DIGIT SP [reason-phrase]. The SP
+// before an empty reason is often missing, that's let through.
+func (resp *Response) parseStatusLine(line string) error {
+	version, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return fmt.Errorf("%w : %q", ErrMalformedStatusLine, line)
+	}
+	if len(version) != 8 || !strings.HasPrefix(version, "HTTP/") || version[6] != '.' ||
+		version[5] < '0' || version[5] > '9' || version[7] < '0' || version[7] > '9' {
+		return fmt.Errorf("%w : %q", ErrMalformedStatusLine, line)
+	}
+	if version[5] != '1' {
+		return fmt.Errorf("%w : %s", ErrUnsupportedHTTPVersion, version)
+	}
+	code, reason, _ := strings.Cut(rest, " ")
+	if len(code) != 3 || code[0] < '1' || code[0] > '9' {
+		return fmt.Errorf("%w : status %q", ErrMalformedStatusLine, code)
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil {
+		return fmt.Errorf("%w : status %q", ErrMalformedStatusLine, code)
+	}
+	if !validReason(reason) {
+		return fmt.Errorf("%w : reason %q", ErrMalformedStatusLine, reason)
+	}
+	resp.HttpVersion = "HTTP/1.1"
+	if version == "HTTP/1.0" {
+		resp.HttpVersion = version
+	}
+	resp.StatusCode = StatusCode(n)
+	resp.Reason = reason
+	return nil
+}
+
+// startBody picks the body framing following RFC 9112 section 6.3
+func (resp *Response) startBody(r *bufio.Reader, method string) error {
+	if resp.StatusCode == StatusSwitchingProtocols {
+		// whatever follows is the new protocol's
+		resp.BodyReader = noBody{}
+		resp.closeAfter = true
+		return nil
+	}
+	if strings.EqualFold(method, "HEAD") || !resp.StatusCode.BodyAllowed() {
+		// Content-Length here is what a GET would have got, there's no body
+		resp.BodyReader = noBody{}
+		resp.ContentLength = 0
+		return nil
+	}
+
+	if resp.Headers.Has("Transfer-Encoding") {
+		if resp.Headers.Has("Content-Length") {
+			// Transfer-Encoding wins, but whoever sent both can't be trusted
+			// with the connection
+			resp.Headers.Del("Content-Length")
+			resp.closeAfter = true
+		}
+		codings := resp.Headers.Tokens("Transfer-Encoding")
+		if len(codings) > 0 && strings.EqualFold(codings[len(codings)-1], "chunked") && resp.HttpVersion != "HTTP/1.0" {
+			resp.BodyReader = &chunkedReader{r: r, trailers: &resp.Trailers}
+			return nil
+		}
+		// not chunked last, the body runs to the end of the connection
+		resp.BodyReader = io.NopCloser(r)
+		resp.closeAfter = true
+		return nil
+	}
+
+	if resp.Headers.Has("Content-Length") {
+		values := resp.Headers.Tokens("Content-Length")
+		for _, v := range values {
+			if v != values[0] {
+				return fmt.Errorf("%w : %s", ErrInvalidContentLength, resp.Headers.Get("Content-Length"))
+			}
+		}
+		length, err := resp.Headers.ContentLength()
+		if err != nil {
+			return fmt.Errorf("%w : %w", ErrInvalidContentLength, err)
+		}
+		if length < 0 {
+			// the field is there but blank
+			return fmt.Errorf("%w : %q", ErrInvalidContentLength, resp.Headers.Get("Content-Length"))
+		}
+		resp.ContentLength = length
+		resp.BodyReader = &lengthReader{r: r, remaining: length}
+		return nil
+	}
+
+	resp.BodyReader = io.NopCloser(r)
+	resp.closeAfter = true
+	return nil
+}
+
+// noBody is the empty body of a response that can't have one
+type noBody struct{}
+
+func (noBody) Read([]byte) (int, error) { return 0, io.EOF }
+func (noBody) Close() error             { return nil }
+
+// lengthReader is a Content-Length body, the connection ending early is
+// io.ErrUnexpectedEOF
+type lengthReader struct {
+	r         *bufio.Reader
+	remaining int64
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	if l.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if err == io.EOF {
+		if l.remaining > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+func (l *lengthReader) Close() error { return nil }
+
+// chunkedReader decodes a chunked body and reads the trailer section after
+// the last chunk
+type chunkedReader struct {
+	r        *bufio.Reader
+	trailers *headers.Headers
+	// left in the current chunk
+	remaining uint64
+	done      bool
+	err       error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.remaining == 0 {
+		if c.err = c.nextChunk(); c.err != nil {
+			return 0, c.err
+		}
+		if c.done {
+			return 0, io.EOF
+		}
+	}
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= uint64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && c.remaining == 0 {
+		err = c.chunkEnd()
+	}
+	c.err = err
+	return n, err
+}
+
+// nextChunk reads a chunk-size line, extensions are ignored. Size 0 is the
+// last chunk and the trailers follow.
+func (c *chunkedReader) nextChunk() error {
+	line, err := readLine(c.r, maxChunkSizeLine, ErrMalformedChunk)
+	if err == io.EOF {
+		// the connection ended between chunks, the body is cut off
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	sizePart, _, _ := strings.Cut(line, ";")
+	sizePart = strings.TrimRight(sizePart, " \t")
+	size, err := strconv.ParseUint(sizePart, 16, 63)
+	if err != nil || sizePart == "" || sizePart[0] == '+' {
+		return fmt.Errorf("%w : size %q", ErrMalformedChunk, sizePart)
+	}
+	if size > 0 {
+		c.remaining = size
+		return nil
+	}
+	if err := readFields(c.r, c.trailers); err != nil {
+		return err
+	}
+	c.done = true
+	return nil
+}
+
+// chunkEnd reads the CRLF after the chunk data
+func (c *chunkedReader) chunkEnd() error {
+	line, err := readLine(c.r, 0, ErrMalformedChunk)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return fmt.Errorf("%w : data past the chunk size", ErrMalformedChunk)
+	}
+	return nil
+}
+
+func (c *chunkedReader) Close() error { return nil }
+
+// readLine reads one line of at most max bytes without its line ending.
+// Responses are read leniently, a bare LF ends a line too. A bad line is
+// reported as malformed.
+func readLine(r *bufio.Reader, max int, malformed error) (string, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		line = append(line, frag...)
+		if len(line) > max+2 {
+			return "", fmt.Errorf("%w : line longer than %d bytes", malformed, max)
+		}
+		if err == nil {
+			break
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	text, _, err := headers.NextLine(line, true)
+	if err != nil {
+		return "", fmt.Errorf("%w : %w", malformed, err)
+	}
+	return string(text), nil
+}
+
+// readFields reads a header or trailer section into h up to the empty line
+func readFields(r *bufio.Reader, h *headers.Headers) error {
+	var section []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		section = append(section, frag...)
+		if len(section) > maxResponseHeaderBytes {
+			return ErrHeadersTooLarge
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if !bytes.HasSuffix(section, []byte("\n\n")) && !bytes.HasSuffix(section, []byte("\n\r\n")) && !isBlankLine(section) {
+			continue
+		}
+		_, done, err := h.ParseLenient(section)
+		if err != nil {
+			return fmt.Errorf("%w : %w", ErrMalformedHeader, err)
+		}
+		if !done {
+			return fmt.Errorf("%w : section didn't end", ErrMalformedHeader)
+		}
+		return nil
+	}
+}
+
+// isBlankLine is an empty section, just the line ending
+func isBlankLine(b []byte) bool {
+	return string(b) == "\r\n" || string(b) == "\n"
+}
@@ -0,0 +1,169 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+func TestResponseFromReader(t *testing.T) {
+	// Test: Content-Length body
+	resp, err := ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\nhello"), "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", resp.HttpVersion)
+	assert.Equal(t, StatusOk, resp.StatusCode)
+	assert.Equal(t, "OK", resp.Reason)
+	assert.Equal(t, "text/plain", resp.Headers.Get("Content-Type"))
+	assert.Equal(t, int64(5), resp.ContentLength)
+	assert.Equal(t, "hello", string(resp.Body))
+	assert.True(t, resp.KeepAlive())
+
+	// Test: Chunked body with extensions and trailers, a byte at a time
+	data := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\n\r\n" +
+		"5;name=value\r\nhello\r\n7\r\n, world\r\n0\r\nX-Sum: abc\r\n\r\n"
+	resp, err = ResponseFromReader(iotest.OneByteReader(strings.NewReader(data)), "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", string(resp.Body))
+	assert.Equal(t, int64(-1), resp.ContentLength)
+	assert.Equal(t, "abc", resp.Trailers.Get("X-Sum"))
+	assert.True(t, resp.KeepAlive())
+
+	// Test: No framing, the body runs until the connection closes
+	resp, err = ResponseFromReader(strings.NewReader("HTTP/1.0 200 OK\r\nConnection: keep-alive\r\n\r\nuntil the end"), "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0", resp.HttpVersion)
+	assert.Equal(t, "until the end", string(resp.Body))
+	assert.False(t, resp.KeepAlive())
+
+	// Test: Bare LF line endings, a missing reason and obs-fold are let
+	// through
+	resp, err = ResponseFromReader(strings.NewReader("HTTP/1.1 204\nX-Long: one\n two\n\n"), "GET")
+	require.NoError(t, err)
+	assert.Equal(t, StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "", resp.Reason)
+	assert.Equal(t, "one two", resp.Headers.Get("X-Long"))
+}
+
+func TestResponseNoBody(t *testing.T) {
+	next := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+	for name, tc := range map[string]struct {
+		method string
+		head   string
+	}{
+		"HEAD": {"HEAD", "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n"},
+		"204":  {"GET", "HTTP/1.1 204 No Content\r\nContent-Length: 100\r\n\r\n"},
+		"304":  {"GET", "HTTP/1.1 304 Not Modified\r\nTransfer-Encoding: chunked\r\n\r\n"},
+	} {
+		r := bufio.NewReader(strings.NewReader(tc.head + next))
+		resp, err := ReadResponse(r, tc.method)
+		require.NoError(t, err, name)
+		body, err := resp.ReadBody()
+		require.NoError(t, err, name)
+		assert.Empty(t, body, name)
+		assert.True(t, resp.KeepAlive(), name)
+
+		// the next response starts right after the head
+		resp, err = ReadResponse(r, "GET")
+		require.NoError(t, err, name)
+		body, err = resp.ReadBody()
+		require.NoError(t, err, name)
+		assert.Equal(t, "ok", string(body), name)
+	}
+
+	// Test: Interim responses are skipped, 101 is returned as it is
+	r := bufio.NewReader(strings.NewReader("HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 103 Early Hints\r\nLink: </a.css>\r\n\r\n" + next))
+	resp, err := ReadResponse(r, "POST")
+	require.NoError(t, err)
+	assert.Equal(t, StatusOk, resp.StatusCode)
+	assert.False(t, resp.Headers.Has("Link"))
+
+	r = bufio.NewReader(strings.NewReader("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n\x81\x05hello"))
+	resp, err = ReadResponse(r, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, StatusSwitchingProtocols, resp.StatusCode)
+	assert.False(t, resp.KeepAlive())
+	rest, _ := io.ReadAll(r)
+	assert.Equal(t, "\x81\x05hello", string(rest))
+}
+
+func TestResponseKeepAlive(t *testing.T) {
+	// Test: Pipelined responses on one connection
+	data := "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\none" +
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\ntwo\r\n0\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 5\r\n\r\nthree"
+	r := bufio.NewReader(iotest.HalfReader(strings.NewReader(data)))
+	for _, want := range []string{"one", "two", "three"} {
+		resp, err := ReadResponse(r, "GET")
+		require.NoError(t, err)
+		body, err := resp.ReadBody()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(body))
+		assert.Equal(t, want != "three", resp.KeepAlive())
+	}
+	_, err := ReadResponse(r, "GET")
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Transfer-Encoding wins over Content-Length but the connection
+	// can't be trusted after
+	resp, err := ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 100\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhi\r\n0\r\n\r\n"), "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(resp.Body))
+	assert.False(t, resp.Headers.Has("Content-Length"))
+	assert.False(t, resp.KeepAlive())
+}
+
+func TestResponseParseErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data string
+		err  error
+	}{
+		"garbage":           {"SSH-2.0-OpenSSH\r\n\r\n", ErrMalformedStatusLine},
+		"short code":        {"HTTP/1.1 20 OK\r\n\r\n", ErrMalformedStatusLine},
+		"letters in code":   {"HTTP/1.1 2x0 OK\r\n\r\n", ErrMalformedStatusLine},
+		"HTTP/2":            {"HTTP/2.0 200 OK\r\n\r\n", ErrUnsupportedHTTPVersion},
+		"bad header":        {"HTTP/1.1 200 OK\r\nNo colon\r\n\r\n", ErrMalformedHeader},
+		"bad length":        {"HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n", ErrInvalidContentLength},
+		"blank length":      {"HTTP/1.1 200 OK\r\nContent-Length: \r\n\r\nab", ErrInvalidContentLength},
+		"conflicting":       {"HTTP/1.1 200 OK\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\nab", ErrInvalidContentLength},
+		"short body":        {"HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nabc", io.ErrUnexpectedEOF},
+		"bad chunk size":    {"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n", ErrMalformedChunk},
+		"chunk overrun":     {"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nabc\r\n0\r\n\r\n", ErrMalformedChunk},
+		"truncated chunked": {"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nab", io.ErrUnexpectedEOF},
+		"no last chunk":     {"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nabcde\r\n", io.ErrUnexpectedEOF},
+		"no chunk end":      {"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nabcde", io.ErrUnexpectedEOF},
+		"truncated head":    {"HTTP/1.1 200 OK\r\nContent-Ty", io.ErrUnexpectedEOF},
+		"huge headers":      {"HTTP/1.1 200 OK\r\nX-Big: " + strings.Repeat("a", maxResponseHeaderBytes) + "\r\n\r\n", ErrHeadersTooLarge},
+	} {
+		_, err := ResponseFromReader(strings.NewReader(tc.data), "GET")
+		require.ErrorIs(t, err, tc.err, name)
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	// Test: What Writer sends, ResponseFromReader reads back
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf, BufferSize: 4}
+	require.NoError(t, w.WriteStatusLine(StatusCreated))
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Set("Trailer", "X-Done")
+	require.NoError(t, w.WriteHeaders(h))
+	io.WriteString(w, "a body longer than the buffer")
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Done", "yes")
+	require.NoError(t, w.WriteTrailers(trailers))
+
+	resp, err := ResponseFromReader(&buf, "POST")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCreated, resp.StatusCode)
+	assert.Equal(t, "Created", resp.Reason)
+	assert.Equal(t, "a body longer than the buffer", string(resp.Body))
+	assert.Equal(t, "yes", resp.Trailers.Get("X-Done"))
+}
@@ -1,139 +1,429 @@
 package response
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	headers "github/gojogourav/http-from-scratch/Headers"
 	"io"
-	"net/http"
 	"strings"
 )
 
 type StatusCode int
 
-type Response struct {
-	StatusCode StatusCode
-	Headers    headers.Headers
-	body       []byte
-}
-
+// Writer writes one response at a time in order: status line, headers, body
+// and for chunked responses trailers. Calls out of that order fail with
+// ErrWriteOrder.
 type Writer struct {
 	io.Writer
+	// Headers are added by WriteHeaders to every response unless the
+	// handler sets the same field, the server puts Connection in here
 	Headers *headers.Headers
+	// HttpVersion used on the status line, HTTP/1.1 when empty
+	HttpVersion string
+	// BufferSize is how much of a body without Content-Length is held back
+	// to send it with one, past that it goes out chunked. Zero means
+	// DefaultBufferSize, negative streams right away.
+	BufferSize int
+	// AcceptEncoding is the request's Accept-Encoding, compressible
+	// responses get gzip or deflate coded when it allows, see
+	// NegotiateEncoding. Empty leaves every body as it is.
+	AcceptEncoding string
+	// Head marks the response to a HEAD request: headers and Content-Length
+	// come out as they would for GET, the body bytes are dropped
+	Head bool
+	// WillClose is asked as the final headers go out whether the connection
+	// ends after this response, "Connection: close" is added if so. The
+	// server uses it when it answers before the request body was read.
+	WillClose func() bool
+
+	state writerState
+	// status of the response being written, 0 before the status line
+	status StatusCode
+	// declared Content-Length, -1 when there is none
+	contentLength int64
+	bodyWritten   int64
+	chunked       bool
+	// encoder compresses the body on its way to writeFramed
+	encoder io.WriteCloser
+	// pending are the final headers while the body is being buffered
+	pending *headers.Headers
+	buf     []byte
+	written bool
+	closing bool
+	aborted bool
 }
 
-func ProxyHTTPinStream(w io.Writer, count int) error {
-	url := fmt.Sprintf("https://httpbin.org/stream/%d", count)
+type writerState int
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to fetch httpbin: %w", err)
-	}
-	defer resp.Body.Close()
+const (
+	stateStatus writerState = iota
+	stateHeaders
+	stateBody
+	stateDone
+)
 
-	_, err = fmt.Fprint(w,
-		"HTTP/1.1 200 OK\r\n"+
-			"Content-Type: application/json\r\n"+
-			"Transfer-Encoding: chunked\r\n\r\n")
-	if err != nil {
-		return err
-	}
+var (
+	ErrInvalidStatus  = fmt.Errorf("Invalid status code or reason phrase")
+	ErrBodyNotAllowed = fmt.Errorf("Response status doesn't allow a body")
+	ErrWriteOrder     = fmt.Errorf("Response written out of order")
+	// ErrContentLengthMismatch is a body longer than the declared
+	// Content-Length, or shorter when the response is finished
+	ErrContentLengthMismatch = fmt.Errorf("Body doesn't match Content-Length")
+	ErrResponseIncomplete    = fmt.Errorf("Response incomplete")
+	// ErrResponseAborted is what Finish says after Abort
+	ErrResponseAborted = fmt.Errorf("Response aborted")
+)
 
-	buf := make([]byte, 32)
-	for {
-		n, err := resp.Body.Read(buf)
-		if n > 0 {
-			chunk := fmt.Sprintf("%x\r\n%s\r\n", n, buf[:n])
-			if _, werr := w.Write([]byte(chunk)); werr != nil {
-				return werr
-			}
-		}
+// Write is WriteBody, so a Writer can be handed to anything taking an
+// io.Writer
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.WriteBody(p)
+}
 
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("read error: %w", err)
-		}
-	}
+// raw sends protocol bytes, marking the response as started
+func (w *Writer) raw(p []byte) error {
+	w.written = true
+	_, err := w.Writer.Write(p)
+	return err
+}
 
-	_, _ = io.WriteString(w, "0\r\n")
-	h := headers.Headers{}
-	// Calculate SHA256 hash and length
-	hash := sha256.Sum256(buf)
-	hashHex := hex.EncodeToString(hash[:])
-	length := fmt.Sprintf("%d", len(buf))
+// Written reports whether anything has been sent for this response yet
+func (w *Writer) Written() bool {
+	return w.written
+}
 
-	h.Set("X-Content-SHA256", hashHex)
-	h.Set("X-Content-Length", length)
+// Closing reports whether the response told the client "Connection: close"
+func (w *Writer) Closing() bool {
+	return w.closing
+}
 
-	if err := WriteTrailers(w, &h); err != nil {
-		return err
-	}
-	_, err = fmt.Fprint(w, "0\r\n\r\n")
-	return err
+// Done reports whether the response is complete
+func (w *Writer) Done() bool {
+	return w.state == stateDone && !w.aborted
 }
 
-const (
-	StatusOk                  StatusCode = 200
-	StatusBadRequest          StatusCode = 400
-	StatusInternalServerError StatusCode = 500
-)
+// Abort gives up on a response that can't be completed, like a proxied body
+// whose upstream failed halfway. Nothing more is sent, not even the last
+// chunk, so the client can't take what it got for the whole response.
+// Finish then fails with ErrResponseAborted and the connection has to be
+// closed.
+func (w *Writer) Abort() {
+	w.state = stateDone
+	w.aborted = true
+	w.closing = true
+	w.encoder = nil
+	w.pending, w.buf = nil, nil
+}
 
+// WriteTrailers writes the trailer section in the order the fields were
+// added, ending it with the empty line
 func WriteTrailers(w io.Writer, h *headers.Headers) error {
-	var err error
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	b := []byte{}
 	h.ForEach(func(key, value string) {
-		if err != nil {
-			return
-		}
-		line := fmt.Sprintf("%s: %s\r\n", strings.TrimSpace(key), strings.TrimSpace(value))
-		_, err = io.WriteString(w, line)
+		b = fmt.Appendf(b, "%s: %s\r\n", strings.TrimSpace(key), strings.TrimSpace(value))
 	})
+	b = fmt.Append(b, "\r\n")
+	_, err := w.Write(b)
+	return err
+}
+
+// WriteStatusLine starts the response with code and its registered reason
+// phrase. Codes without one get an empty reason, the space before it stays.
+func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason is WriteStatusLine with a reason phrase of our own
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
+	if w.state != stateStatus {
+		return fmt.Errorf("%w : status line already written", ErrWriteOrder)
+	}
+	statusLine, err := w.statusLine(statusCode, reason)
 	if err != nil {
 		return err
 	}
+	w.status = statusCode
+	w.state = stateHeaders
+	return w.raw(statusLine)
+}
 
-	_, err = io.WriteString(w, "\r\n")
+// WriteContinue sends the interim "100 Continue" response. It doesn't count
+// as starting the response, the handler still writes its own status line.
+func (w *Writer) WriteContinue() error {
+	statusLine, err := w.statusLine(StatusContinue, StatusText(StatusContinue))
+	if err != nil {
+		return err
+	}
+	_, err = w.Writer.Write(append(statusLine, "\r\n"...))
 	return err
 }
-func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
-	statusLine := []byte{}
-	switch statusCode {
-	case StatusOk:
-		statusLine = []byte("HTTP/1.1 200 ok\r\n")
-	case StatusBadRequest:
-		statusLine = ([]byte("HTTP/1.1 400 Bad Request\r\n"))
-	case StatusInternalServerError:
-		statusLine = ([]byte("HTTP/1.1 500 Internal Server Error\r\n"))
-	default:
-		return fmt.Errorf("Unrecognized Error Code")
-	}
-
-	_, err := w.Writer.Write(statusLine)
-	return err
+
+func (w *Writer) statusLine(statusCode StatusCode, reason string) ([]byte, error) {
+	if !validStatusCode(statusCode) {
+		return nil, fmt.Errorf("%w : %d", ErrInvalidStatus, statusCode)
+	}
+	if !validReason(reason) {
+		return nil, fmt.Errorf("%w : reason %q", ErrInvalidStatus, reason)
+	}
+	version := w.HttpVersion
+	if version == "" {
+		version = "HTTP/1.1"
+	}
+	return fmt.Appendf(nil, "%s %03d %s\r\n", version, statusCode, reason), nil
 }
+
+// WriteHeaders writes h plus the writer's own Headers. Nothing is written
+// if any name or value is invalid, so reflected input can't inject CRLF.
+// Framing fields are left out where the status doesn't allow content, and
+// a 1xx only gets h since the writer's Headers belong to the final response.
+// Without Content-Length or Transfer-Encoding in h the headers wait for the
+// body to pick the framing, see BufferSize.
 func (w *Writer) WriteHeaders(h *headers.Headers) error {
+	if w.state != stateHeaders {
+		return fmt.Errorf("%w : headers need a status line first and go out once", ErrWriteOrder)
+	}
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	if w.Headers != nil {
+		if err := w.Headers.Validate(); err != nil {
+			return err
+		}
+	}
+	if w.status.Informational() {
+		// another status line follows, this wasn't the response yet
+		b := []byte{}
+		h.ForEach(func(key, value string) {
+			if !w.omitField(key) {
+				b = fmt.Appendf(b, "%s: %s\r\n", key, value)
+			}
+		})
+		w.status = 0
+		w.state = stateStatus
+		return w.raw(fmt.Append(b, "\r\n"))
+	}
+	if err := w.startBody(h); err != nil {
+		return err
+	}
+	w.state = stateBody
+	w.negotiateEncoding(h)
+	if w.status.BodyAllowed() && !w.chunked && !w.hasLength(h) && w.BufferSize >= 0 {
+		// no length yet, hold the headers back until we know it
+		w.pending = h
+		return nil
+	}
+	return w.sendHeaders(h)
+}
+
+// sendHeaders writes the final header section, h first and then the
+// writer's Headers that h doesn't override
+func (w *Writer) sendHeaders(h *headers.Headers) error {
+	if w.WillClose != nil && w.WillClose() {
+		h.Set("Connection", "close")
+	}
 	b := []byte{}
 	h.ForEach(func(key, value string) {
-		b = fmt.Appendf(b, "%s: %s\r\n", key, value)
+		if !w.omitField(key) {
+			b = fmt.Appendf(b, "%s: %s\r\n", key, value)
+		}
 	})
-	b = fmt.Append(b, "\r\n")
-	_, err := w.Writer.Write(b)
-	return err
+	w.closing = h.HasToken("Connection", "close")
+	if w.Headers != nil {
+		w.Headers.ForEach(func(key, value string) {
+			if !h.Has(key) && !w.omitField(key) && !(w.encoder != nil && strings.EqualFold(key, "Content-Length")) {
+				b = fmt.Appendf(b, "%s: %s\r\n", key, value)
+			}
+		})
+		if !h.Has("Connection") {
+			w.closing = w.Headers.HasToken("Connection", "close")
+		}
+	}
+	if w.status.BodyAllowed() && !w.chunked && !w.hasLength(h) {
+		// the body ends when the connection does
+		w.closing = true
+	}
+	return w.raw(fmt.Append(b, "\r\n"))
 }
-func (w *Writer) WriteBody(p []byte) (int, error) {
-	n, err := w.Writer.Write(p)
+
+// startBody works out the body framing from the fields about to be sent
+func (w *Writer) startBody(h *headers.Headers) error {
+	w.contentLength = -1
+	w.bodyWritten = 0
+	w.chunked = false
+	if !w.status.BodyAllowed() {
+		w.contentLength = 0
+		return nil
+	}
+
+	framing := h
+	if w.Headers != nil && !h.Has("Transfer-Encoding") && !h.Has("Content-Length") {
+		framing = w.Headers
+	}
+	if framing.Has("Transfer-Encoding") {
+		w.chunked = framing.HasToken("Transfer-Encoding", "chunked")
+		return nil
+	}
+	length, err := framing.ContentLength()
 	if err != nil {
-		return 0, err
+		return err
+	}
+	w.contentLength = length
+	return nil
+}
+
+// hasLength reports whether the response carries a Content-Length, from h
+// or the writer's Headers. A compressed body only has the one Finish sets.
+func (w *Writer) hasLength(h *headers.Headers) bool {
+	if h.Has("Content-Length") {
+		return true
+	}
+	return w.encoder == nil && w.Headers != nil && w.Headers.Has("Content-Length")
+}
+
+// omitField reports whether key must not be sent with the current status:
+// no Transfer-Encoding without content, and no Content-Length on 1xx and 204
+// either (a 304 may still say how long the 200 would have been). A chunked
+// response doesn't get a Content-Length either.
+func (w *Writer) omitField(key string) bool {
+	if w.status.BodyAllowed() {
+		return w.chunked && strings.EqualFold(key, "Content-Length")
+	}
+	if strings.EqualFold(key, "Transfer-Encoding") {
+		return true
+	}
+	return strings.EqualFold(key, "Content-Length") && w.status != StatusNotModified
+}
+
+// WriteBody writes content, which 1xx, 204 and 304 responses can't have.
+// Without a status line and headers it first sends a 200 with a text/plain
+// Content-Type. More than the declared Content-Length is refused, a chunked
+// body gets every write framed as one chunk.
+func (w *Writer) WriteBody(p []byte) (int, error) {
+	switch w.state {
+	case stateStatus:
+		if err := w.WriteStatusLine(StatusOk); err != nil {
+			return 0, err
+		}
+		fallthrough
+	case stateHeaders:
+		h := headers.NewHeaders()
+		h.Set("Content-Type", "text/plain")
+		if err := w.WriteHeaders(h); err != nil {
+			return 0, err
+		}
+	case stateDone:
+		return 0, fmt.Errorf("%w : body after the response ended", ErrWriteOrder)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if !w.status.BodyAllowed() {
+		return 0, fmt.Errorf("%w : %d", ErrBodyNotAllowed, w.status)
+	}
+	if w.contentLength >= 0 && w.bodyWritten+int64(len(p)) > w.contentLength {
+		return 0, fmt.Errorf("%w : %d bytes would go over %d", ErrContentLengthMismatch, w.bodyWritten+int64(len(p)), w.contentLength)
+	}
+	w.bodyWritten += int64(len(p))
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.writeFramed(p)
+}
+
+// writeFramed puts body bytes on the wire the way the headers said: held
+// back while the length isn't known yet, as a chunk, or as they are
+func (w *Writer) writeFramed(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.pending != nil {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) > w.bufferSize() {
+			if err := w.stream(); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	w.written = true
+	if w.Head {
+		return len(p), nil
+	}
+	if w.chunked {
+		if _, err := w.Writer.Write(appendChunk(nil, p)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return w.Writer.Write(p)
+}
+
+// WriteTrailers ends a chunked body with the last chunk and the trailer
+// fields in h
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	if err := w.closeEncoder(); err != nil {
+		return err
+	}
+	if w.pending != nil && w.HttpVersion != "HTTP/1.0" {
+		if err := w.stream(); err != nil {
+			return err
+		}
+	}
+	if w.state != stateBody || !w.chunked {
+		return fmt.Errorf("%w : trailers only follow a chunked body", ErrWriteOrder)
+	}
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	w.state = stateDone
+	if w.Head {
+		return nil
+	}
+	if err := w.raw([]byte("0\r\n")); err != nil {
+		return err
+	}
+	return WriteTrailers(w.Writer, h)
+}
+
+// Finish completes the response, ending a chunked body or checking that a
+// Content-Length body was written in full. If it fails the connection can't
+// be reused.
+func (w *Writer) Finish() error {
+	if w.aborted {
+		return ErrResponseAborted
+	}
+	switch w.state {
+	case stateDone:
+		return nil
+	case stateBody:
+		if err := w.closeEncoder(); err != nil {
+			return err
+		}
+		if w.pending != nil {
+			// everything fit, send it with its length
+			w.pending.SetContentLength(int64(len(w.buf)))
+			if err := w.sendBuffered(); err != nil {
+				return err
+			}
+		}
+		w.state = stateDone
+		if w.chunked && !w.Head {
+			return w.raw([]byte("0\r\n\r\n"))
+		}
+		// a response to HEAD declares the length without sending the body
+		if w.contentLength >= 0 && w.bodyWritten < w.contentLength && !w.Head {
+			return fmt.Errorf("%w : %d of %d bytes written", ErrContentLengthMismatch, w.bodyWritten, w.contentLength)
+		}
+		return nil
 	}
-	return n, nil
+	return fmt.Errorf("%w : no final status line and headers", ErrResponseIncomplete)
 }
 
 func GetDefaultHeaders(contentLen int) *headers.Headers {
 	h := headers.NewHeaders()
-	h.Set("Content-Length", fmt.Sprintf("%d", contentLen))
-	h.Set("Connection", "close")
+	h.SetContentLength(int64(contentLen))
 	h.Set("Content-Type", "text/plain")
 
 	return h
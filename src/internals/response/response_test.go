@@ -0,0 +1,390 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+func TestWriteHeadersValidation(t *testing.T) {
+	// Test: A header with CRLF in it is refused and nothing goes out
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	buf.Reset()
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Set("Location", "/home\r\nSet-Cookie: admin=1")
+	require.ErrorIs(t, w.WriteHeaders(h), headers.ErrInvalidField)
+	assert.Empty(t, buf.String())
+
+	// Test: Same for trailers
+	buf.Reset()
+	h = headers.NewHeaders()
+	h.Set("X-Checksum", "abc\n")
+	require.ErrorIs(t, WriteTrailers(&buf, h), headers.ErrInvalidField)
+	assert.Empty(t, buf.String())
+
+	// Test: Valid headers are written in order
+	buf.Reset()
+	h = headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "Content-Type: text/plain\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\nContent-Length: 0\r\n\r\n", buf.String())
+}
+
+func TestStatusLine(t *testing.T) {
+	cases := map[StatusCode]string{
+		StatusOk:                 "HTTP/1.1 200 OK\r\n",
+		StatusCreated:            "HTTP/1.1 201 Created\r\n",
+		StatusMovedPermanently:   "HTTP/1.1 301 Moved Permanently\r\n",
+		StatusNotFound:           "HTTP/1.1 404 Not Found\r\n",
+		StatusMethodNotAllowed:   "HTTP/1.1 405 Method Not Allowed\r\n",
+		StatusContentTooLarge:    "HTTP/1.1 413 Content Too Large\r\n",
+		StatusURITooLong:         "HTTP/1.1 414 URI Too Long\r\n",
+		StatusServiceUnavailable: "HTTP/1.1 503 Service Unavailable\r\n",
+		// unregistered codes keep the space before the empty reason
+		299: "HTTP/1.1 299 \r\n",
+		599: "HTTP/1.1 599 \r\n",
+	}
+	for code, want := range cases {
+		var buf bytes.Buffer
+		w := &Writer{Writer: &buf}
+		require.NoError(t, w.WriteStatusLine(code))
+		assert.Equal(t, want, buf.String())
+	}
+
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf, HttpVersion: "HTTP/1.0"}
+	require.NoError(t, w.WriteStatusLineReason(StatusOk, "Fine, Thanks"))
+	assert.Equal(t, "HTTP/1.0 200 Fine, Thanks\r\n", buf.String())
+
+	buf.Reset()
+	w = &Writer{Writer: &buf}
+	require.ErrorIs(t, w.WriteStatusLine(99), ErrInvalidStatus)
+	require.ErrorIs(t, w.WriteStatusLine(1000), ErrInvalidStatus)
+	require.ErrorIs(t, w.WriteStatusLineReason(StatusOk, "OK\r\nX-Injected: 1"), ErrInvalidStatus)
+	assert.Empty(t, buf.String())
+	assert.False(t, w.Written())
+}
+
+func TestBodylessStatus(t *testing.T) {
+	for _, code := range []StatusCode{StatusContinue, StatusNoContent, StatusNotModified} {
+		assert.False(t, code.BodyAllowed(), "%d", code)
+	}
+	assert.True(t, StatusOk.BodyAllowed())
+	assert.True(t, StatusCode(299).BodyAllowed())
+
+	// Test: 204 drops framing fields, even the server's defaults
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf, Headers: headers.NewHeaders()}
+	w.Headers.Set("Connection", "close")
+	h := GetDefaultHeaders(0)
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\nContent-Type: text/plain\r\nConnection: close\r\n\r\n", buf.String())
+	_, err := w.WriteBody([]byte("nope"))
+	require.ErrorIs(t, err, ErrBodyNotAllowed)
+	_, err = w.WriteBody(nil)
+	require.NoError(t, err)
+
+	// Test: 304 keeps Content-Length
+	buf.Reset()
+	w = &Writer{Writer: &buf}
+	require.NoError(t, w.WriteStatusLine(StatusNotModified))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(42)))
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\nContent-Length: 42\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+
+	// Test: An interim 103 then the final response
+	buf.Reset()
+	w = &Writer{Writer: &buf, Headers: headers.NewHeaders()}
+	w.Headers.Set("Connection", "close")
+	h = headers.NewHeaders()
+	h.Set("Link", "</style.css>; rel=preload")
+	require.NoError(t, w.WriteStatusLine(StatusEarlyHints))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.False(t, w.Closing())
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	_, err = w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	assert.True(t, w.Closing())
+	assert.Equal(t, "HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\nContent-Length: 2\r\nContent-Type: text/plain\r\nConnection: close\r\n\r\nhi", buf.String())
+}
+
+func TestWriterOrder(t *testing.T) {
+	// Test: Headers before the status line, twice, or after the body
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf}
+	require.ErrorIs(t, w.WriteHeaders(GetDefaultHeaders(0)), ErrWriteOrder)
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.ErrorIs(t, w.WriteStatusLine(StatusOk), ErrWriteOrder)
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	require.ErrorIs(t, w.WriteHeaders(GetDefaultHeaders(5)), ErrWriteOrder)
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.Done())
+	_, err = w.WriteBody([]byte("!"))
+	require.ErrorIs(t, err, ErrWriteOrder)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\nhello", buf.String())
+
+	// Test: A body write on its own sends a 200 and the default headers
+	buf.Reset()
+	w = &Writer{Writer: &buf}
+	_, err = w.Write([]byte("implicit"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 8\r\n\r\nimplicit", buf.String())
+
+	// Test: Only the headers are implicit once the status is out
+	buf.Reset()
+	w = &Writer{Writer: &buf}
+	require.NoError(t, w.WriteStatusLine(StatusNotFound))
+	_, err = w.WriteBody([]byte("gone"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\nContent-Type: text/plain\r\nContent-Length: 4\r\n\r\ngone", buf.String())
+
+	// Test: Trailers only after a chunked body
+	w = &Writer{Writer: &buf}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	require.ErrorIs(t, w.WriteTrailers(headers.NewHeaders()), ErrWriteOrder)
+
+	// Test: Nothing written is an incomplete response
+	w = &Writer{Writer: &buf}
+	require.ErrorIs(t, w.Finish(), ErrResponseIncomplete)
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.ErrorIs(t, w.Finish(), ErrResponseIncomplete)
+}
+
+func TestWriterContentLength(t *testing.T) {
+	// Test: Writing past Content-Length is refused, nothing goes out
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(4)))
+	buf.Reset()
+	_, err := w.WriteBody([]byte("abc"))
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte("de"))
+	require.ErrorIs(t, err, ErrContentLengthMismatch)
+	assert.Equal(t, "abc", buf.String())
+
+	// Test: Finishing short is a mismatch too
+	require.ErrorIs(t, w.Finish(), ErrContentLengthMismatch)
+
+	// Test: A bad Content-Length isn't sent at all
+	buf.Reset()
+	w = &Writer{Writer: &buf}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	buf.Reset()
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "-1")
+	require.ErrorIs(t, w.WriteHeaders(h), headers.ErrBadContentLength)
+	assert.Empty(t, buf.String())
+
+	// Test: Without any length and no buffering the body runs until the
+	// connection closes
+	w = &Writer{Writer: &buf, BufferSize: -1}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	h = headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.True(t, w.Closing())
+	_, err = w.WriteBody([]byte("as much as we like"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+
+	// Test: A chunked response drops Content-Length and Finish ends it
+	buf.Reset()
+	w = &Writer{Writer: &buf}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	h = GetDefaultHeaders(0)
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.False(t, w.Closing())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhi\r\n0\r\n\r\n", buf.String())
+}
+
+func TestChunkedBody(t *testing.T) {
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf}
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Set("Content-Length", "99")
+	h.Set("Trailer", "X-Checksum")
+	body, err := w.ChunkedBody(h)
+	require.NoError(t, err)
+
+	_, err = body.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = io.WriteString(body, "chunked world")
+	require.NoError(t, err)
+	// an empty write would end the body early, it's skipped
+	_, err = body.Write(nil)
+	require.NoError(t, err)
+
+	body.Trailer.Set("X-Checksum", "abc")
+	require.NoError(t, body.Close())
+	require.NoError(t, body.Close())
+	assert.True(t, w.Done())
+	_, err = body.Write([]byte("late"))
+	require.ErrorIs(t, err, ErrWriteOrder)
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\nTrailer: X-Checksum\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"6\r\nhello \r\nd\r\nchunked world\r\n0\r\nX-Checksum: abc\r\n\r\n", buf.String())
+
+	// Test: Undeclared trailers are refused, the body can still be ended
+	buf.Reset()
+	w = &Writer{Writer: &buf}
+	body, err = w.ChunkedBody(nil)
+	require.NoError(t, err)
+	body.Trailer.Set("X-Surprise", "1")
+	require.ErrorIs(t, body.Close(), ErrUndeclaredTrailer)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n0\r\n\r\n"))
+
+	// Test: Framing fields can't be declared as trailers
+	h = headers.NewHeaders()
+	h.Set("Trailer", "Content-Length")
+	_, err = (&Writer{Writer: &buf}).ChunkedBody(h)
+	require.ErrorIs(t, err, ErrUndeclaredTrailer)
+
+	// Test: No chunked for HTTP/1.0
+	_, err = (&Writer{Writer: &buf, HttpVersion: "HTTP/1.0"}).ChunkedBody(nil)
+	require.ErrorIs(t, err, ErrChunkedNotSupported)
+	// Test: An aborted body never gets its last chunk
+	buf.Reset()
+	w = &Writer{Writer: &buf}
+	body, err = w.ChunkedBody(nil)
+	require.NoError(t, err)
+	io.WriteString(body, "half")
+	w.Abort()
+	_, err = io.WriteString(body, "more")
+	require.ErrorIs(t, err, ErrWriteOrder)
+	require.Error(t, body.Close())
+	require.ErrorIs(t, w.Finish(), ErrResponseAborted)
+	assert.False(t, w.Done())
+	assert.True(t, w.Closing())
+	assert.True(t, strings.HasSuffix(buf.String(), "4\r\nhalf\r\n"))
+}
+
+func TestAutomaticFraming(t *testing.T) {
+	// Test: A small body is buffered and sent with its length
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf, Headers: headers.NewHeaders()}
+	w.Headers.Set("Connection", "keep-alive")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/html")
+	require.NoError(t, w.WriteHeaders(h))
+	io.WriteString(w, "<p>")
+	io.WriteString(w, "hi</p>")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+	require.NoError(t, w.Finish())
+	assert.False(t, w.Closing())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 9\r\nConnection: keep-alive\r\n\r\n<p>hi</p>", buf.String())
+
+	// Test: Past the buffer size it switches to chunked
+	buf.Reset()
+	w = &Writer{Writer: &buf, BufferSize: 4}
+	io.WriteString(w, "abc")
+	io.WriteString(w, "defg")
+	io.WriteString(w, "h")
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"7\r\nabcdefg\r\n1\r\nh\r\n0\r\n\r\n", buf.String())
+
+	// Test: Flush switches too, even with nothing buffered
+	buf.Reset()
+	w = &Writer{Writer: &buf}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", buf.String())
+	io.WriteString(w, "tick")
+	require.NoError(t, w.Flush())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n4\r\ntick\r\n0\r\n\r\n", buf.String())
+
+	// Test: HTTP/1.0 has no chunked, the connection has to close instead
+	buf.Reset()
+	w = &Writer{Writer: &buf, HttpVersion: "HTTP/1.0", BufferSize: 2, Headers: headers.NewHeaders()}
+	w.Headers.Set("Connection", "keep-alive")
+	io.WriteString(w, "long body")
+	require.NoError(t, w.Finish())
+	assert.True(t, w.Closing())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\nConnection: close\r\n\r\nlong body", buf.String())
+
+	// Test: Trailers force chunked
+	buf.Reset()
+	w = &Writer{Writer: &buf}
+	io.WriteString(w, "x")
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Done", "yes")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n1\r\nx\r\n0\r\nX-Done: yes\r\n\r\n", buf.String())
+}
+
+func TestHeadResponse(t *testing.T) {
+	// Test: The headers a GET would get, no body
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf, Head: true}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(9)))
+	n, err := w.WriteBody([]byte("some body"))
+	require.NoError(t, err)
+	assert.Equal(t, 9, n)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 9\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+
+	// Test: A handler that only declares the length is done too
+	buf.Reset()
+	w = &Writer{Writer: &buf, Head: true}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.Done())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+
+	// Test: Compression leaves the declared length alone
+	buf.Reset()
+	w = &Writer{Writer: &buf, Head: true, AcceptEncoding: "gzip"}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5000)))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5000\r\nContent-Type: text/plain\r\nVary: Accept-Encoding\r\n\r\n", buf.String())
+
+	// Test: A buffered body still gets its length
+	buf.Reset()
+	w = &Writer{Writer: &buf, Head: true}
+	io.WriteString(w, "<p>hi</p>")
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 9\r\n\r\n", buf.String())
+
+	// Test: A chunked one gets neither chunks nor the last chunk
+	buf.Reset()
+	w = &Writer{Writer: &buf, Head: true}
+	cw, err := w.ChunkedBody(nil)
+	require.NoError(t, err)
+	io.WriteString(cw, "chunk")
+	require.NoError(t, cw.Close())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n", buf.String())
+}
@@ -0,0 +1,181 @@
+package response
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	headers "github/gojogourav/http-from-scratch/Headers"
+)
+
+var (
+	// ErrStreamClosed is returned by an EventStream once it was closed or
+	// the client went away
+	ErrStreamClosed = fmt.Errorf("Event stream closed")
+	ErrInvalidEvent = fmt.Errorf("Invalid event field")
+)
+
+// Event is one Server-Sent Event. Only Data is required, a multi-line Data
+// is sent as one data field per line.
+type Event struct {
+	// Event names the event type, the client's "message" when empty
+	Event string
+	// ID becomes the client's last event ID, sent back as Last-Event-ID
+	// when it reconnects
+	ID string
+	// Retry tells the client how long to wait before reconnecting
+	Retry time.Duration
+	Data  string
+}
+
+// EventStream is a text/event-stream response (the WHATWG HTML "Server-sent
+// events" section). Every event is flushed right away. A failed write means
+// the client is gone, Done is closed and everything after returns
+// ErrStreamClosed. Send, Comment and Close may be called from different
+// goroutines, Close has to happen before the handler returns.
+type EventStream struct {
+	// LastEventID is the Last-Event-ID the client reconnected with, events
+	// after it are the ones it missed
+	LastEventID string
+
+	w    *Writer
+	mu   sync.Mutex
+	err  error
+	done chan struct{}
+	stop chan struct{}
+}
+
+// EventStream starts an event stream response, a 200 goes out first if no
+// status line was written. lastEventID is the request's Last-Event-ID.
+// HTTP/1.1 gets chunked output, HTTP/1.0 a body that ends with the
+// connection.
+func (w *Writer) EventStream(lastEventID string) (*EventStream, error) {
+	if w.state == stateStatus {
+		if err := w.WriteStatusLine(StatusOk); err != nil {
+			return nil, err
+		}
+	}
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/event-stream; charset=utf-8")
+	h.Set("Cache-Control", "no-cache")
+	if w.HttpVersion != "HTTP/1.0" {
+		h.Set("Transfer-Encoding", "chunked")
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return nil, err
+	}
+	// the headers go out now, the client is waiting for them
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return &EventStream{
+		LastEventID: lastEventID,
+		w:           w,
+		done:        make(chan struct{}),
+		stop:        make(chan struct{}),
+	}, nil
+}
+
+// Send writes e and flushes it
+func (s *EventStream) Send(e Event) error {
+	b, err := appendEvent(nil, e)
+	if err != nil {
+		return err
+	}
+	return s.write(b)
+}
+
+// Comment sends a comment line, clients ignore it but it keeps idle
+// connections from being dropped and notices a client that left
+func (s *EventStream) Comment(text string) error {
+	if strings.ContainsAny(text, "\r\n") {
+		return fmt.Errorf("%w : comment spans lines", ErrInvalidEvent)
+	}
+	return s.write(fmt.Appendf(nil, ": %s\n\n", text))
+}
+
+// Heartbeat sends an empty comment every interval until the stream ends
+func (s *EventStream) Heartbeat(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.write([]byte(":\n\n")) != nil {
+					return
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Done is closed when the stream ends, by Close or because the client
+// disconnected
+func (s *EventStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the response, the heartbeat stops with it
+func (s *EventStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil
+	}
+	s.end(ErrStreamClosed)
+	return s.w.Finish()
+}
+
+func (s *EventStream) write(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if _, err := s.w.WriteBody(b); err != nil {
+		s.end(fmt.Errorf("%w : %w", ErrStreamClosed, err))
+		return s.err
+	}
+	if err := s.w.Flush(); err != nil {
+		s.end(fmt.Errorf("%w : %w", ErrStreamClosed, err))
+		return s.err
+	}
+	return nil
+}
+
+// end marks the stream finished, s.mu has to be held
+func (s *EventStream) end(err error) {
+	s.err = err
+	close(s.stop)
+	close(s.done)
+}
+
+// appendEvent frames e as event stream fields. Names and IDs can't hold
+// line breaks, an ID can't hold NUL either since clients ignore it then.
+func appendEvent(dst []byte, e Event) ([]byte, error) {
+	if strings.ContainsAny(e.Event, "\r\n") {
+		return nil, fmt.Errorf("%w : event name spans lines", ErrInvalidEvent)
+	}
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return nil, fmt.Errorf("%w : id has a line break or NUL", ErrInvalidEvent)
+	}
+	if e.Event != "" {
+		dst = fmt.Appendf(dst, "event: %s\n", e.Event)
+	}
+	if e.ID != "" {
+		dst = fmt.Appendf(dst, "id: %s\n", e.ID)
+	}
+	if e.Retry > 0 {
+		dst = fmt.Appendf(dst, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		dst = fmt.Appendf(dst, "data: %s\n", line)
+	}
+	return append(dst, '\n'), nil
+}
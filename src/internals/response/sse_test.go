@@ -0,0 +1,119 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hangUp accepts a few writes and then fails like a closed connection
+type hangUp struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writes int
+}
+
+func (c *hangUp) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writes == 0 {
+		return 0, fmt.Errorf("broken pipe")
+	}
+	c.writes--
+	return c.buf.Write(p)
+}
+
+func (c *hangUp) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.String()
+}
+
+func TestEventFraming(t *testing.T) {
+	b, err := appendEvent(nil, Event{Event: "update", ID: "42", Retry: 3 * time.Second, Data: "line one\r\nline two\rthree"})
+	require.NoError(t, err)
+	assert.Equal(t, "event: update\nid: 42\nretry: 3000\ndata: line one\ndata: line two\ndata: three\n\n", string(b))
+
+	b, err = appendEvent(nil, Event{})
+	require.NoError(t, err)
+	assert.Equal(t, "data: \n\n", string(b))
+
+	_, err = appendEvent(nil, Event{Event: "a\nb"})
+	require.ErrorIs(t, err, ErrInvalidEvent)
+	_, err = appendEvent(nil, Event{ID: "a\x00"})
+	require.ErrorIs(t, err, ErrInvalidEvent)
+}
+
+func TestEventStream(t *testing.T) {
+	// Test: Headers go out at once, every event as its own chunk
+	var buf bytes.Buffer
+	w := &Writer{Writer: &buf}
+	s, err := w.EventStream("7")
+	require.NoError(t, err)
+	assert.Equal(t, "7", s.LastEventID)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/event-stream; charset=utf-8\r\nCache-Control: no-cache\r\nTransfer-Encoding: chunked\r\n\r\n", buf.String())
+	buf.Reset()
+	require.NoError(t, s.Send(Event{ID: "8", Data: "hi"}))
+	assert.Equal(t, "10\r\nid: 8\ndata: hi\n\n\r\n", buf.String())
+	require.NoError(t, s.Comment("still here"))
+	require.NoError(t, s.Close())
+	assert.Equal(t, "10\r\nid: 8\ndata: hi\n\n\r\ne\r\n: still here\n\n\r\n0\r\n\r\n", buf.String())
+	require.ErrorIs(t, s.Send(Event{Data: "late"}), ErrStreamClosed)
+	assert.True(t, w.Done())
+
+	// Test: HTTP/1.0 streams until the connection closes
+	buf.Reset()
+	w = &Writer{Writer: &buf, HttpVersion: "HTTP/1.0"}
+	s, err = w.EventStream("")
+	require.NoError(t, err)
+	require.NoError(t, s.Send(Event{Data: "hi"}))
+	require.NoError(t, s.Close())
+	assert.True(t, w.Closing())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Type: text/event-stream; charset=utf-8\r\nCache-Control: no-cache\r\nConnection: close\r\n\r\ndata: hi\n\n", buf.String())
+
+	// Test: A bufio.Writer underneath is flushed with every event
+	buf.Reset()
+	bw := bufio.NewWriter(&buf)
+	w = &Writer{Writer: bw}
+	s, err = w.EventStream("")
+	require.NoError(t, err)
+	require.NoError(t, s.Send(Event{Data: "now"}))
+	assert.True(t, strings.HasSuffix(buf.String(), "data: now\n\n\r\n"))
+}
+
+func TestEventStreamDisconnect(t *testing.T) {
+	// Test: A failed write ends the stream and closes Done
+	conn := &hangUp{writes: 3}
+	w := &Writer{Writer: conn}
+	s, err := w.EventStream("")
+	require.NoError(t, err)
+	require.NoError(t, s.Send(Event{Data: "one"}))
+	require.ErrorIs(t, s.Send(Event{Data: "two"}), ErrStreamClosed)
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("Done still open after the client left")
+	}
+	require.NoError(t, s.Close())
+
+	// Test: The heartbeat finds out by itself
+	conn = &hangUp{writes: 4}
+	w = &Writer{Writer: conn}
+	s, err = w.EventStream("")
+	require.NoError(t, err)
+	s.Heartbeat(time.Millisecond)
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat didn't notice the client left")
+	}
+	assert.Equal(t, 2, strings.Count(conn.String(), ":\n\n"))
+	require.ErrorIs(t, s.Comment("anyone?"), ErrStreamClosed)
+}
@@ -2,16 +2,37 @@ package server
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	headers "github/gojogourav/http-from-scratch/Headers"
 	request "github/gojogourav/http-from-scratch/Request"
 	"github/gojogourav/http-from-scratch/internals/response"
 	"io"
 	"net"
+	"time"
 )
 
 type Server struct {
 	Closed  bool
 	Handler Handler
+	Limits  request.Limits
+
+	// IdleTimeout is how long a connection may sit between requests, it also
+	// bounds how long the client can take to send request line and headers
+	IdleTimeout time.Duration
+	// MaxRequestsPerConn closes the connection after that many requests,
+	// zero means no cap
+	MaxRequestsPerConn int
+	// LenientParsing relaxes the parser, see request.Parser.Lenient. Leave
+	// it off unless some client really needs it.
+	LenientParsing bool
+	// ResponseBufferSize is passed on as response.Writer.BufferSize, how
+	// much of a response without Content-Length gets buffered to add one
+	ResponseBufferSize int
+	// DisableCompression sends every response body as the handler wrote
+	// it, otherwise text-like bodies are gzip or deflate coded when the
+	// client's Accept-Encoding allows
+	DisableCompression bool
 }
 type HandlerBody struct {
 	StatusCode response.StatusCode
@@ -20,43 +41,146 @@ type HandlerBody struct {
 
 type Handler func(w *response.Writer, req *request.Request) *HandlerBody
 
+const (
+	defaultIdleTimeout = 60 * time.Second
+	defaultMaxRequests = 1000
+	// unread request body we're willing to read and throw away to keep the
+	// connection, past that closing is cheaper
+	maxDrainBytes = 256 * 1024
+)
+
+// deadliner is the part of net.Conn we need for timeouts
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// runConnection serves requests one after the other, so pipelined requests
+// get their responses in the order they were sent
 func runConnection(s *Server, conn io.ReadWriteCloser) {
 	defer conn.Close()
 
-	w := &response.Writer{
-		Writer: conn,
+	parser := request.NewParser(conn, s.Limits)
+	parser.Lenient = s.LenientParsing
+	for served := 1; !s.Closed; served++ {
+		if !serveRequest(s, conn, parser, served) {
+			return
+		}
 	}
+}
 
-	if s.Closed {
-		return
+// serveRequest handles the nth request of the connection and reports
+// whether the connection can be used for another one
+func serveRequest(s *Server, conn io.ReadWriteCloser, parser *request.Parser, n int) bool {
+	w := &response.Writer{
+		Writer:     conn,
+		Headers:    headers.NewHeaders(),
+		BufferSize: s.ResponseBufferSize,
 	}
-	headers := response.GetDefaultHeaders(0)
 
-	r, err := request.RequestFromReader(conn)
+	dl, canTimeout := conn.(deadliner)
+	if canTimeout && s.IdleTimeout > 0 {
+		dl.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+	}
+	r, err := parser.Next()
 	if err != nil {
-		w.WriteStatusLine(response.StatusBadRequest)
-		w.WriteHeaders(headers)
-		return
+		writeParseError(w, err)
+		return false
+	}
+	if canTimeout {
+		dl.SetReadDeadline(time.Time{})
+	}
+	w.HttpVersion = r.RequestLine.ResponseVersion()
+	w.Head = r.RequestLine.Method == "HEAD"
+	if !s.DisableCompression {
+		w.AcceptEncoding = r.Headers.Get("Accept-Encoding")
+	}
+
+	switch r.Expect() {
+	case "":
+	case "100-continue":
+		r.OnContinue(w.WriteContinue)
+	default:
+		writeError(w, response.StatusExpectationFailed, "Unsupported expectation")
+		return false
+	}
+
+	// a response that goes out before the body was read has to say whether
+	// the body is going to be read at all
+	w.WillClose = func() bool {
+		return r.WaitingForContinue() || r.UnreadBody() > maxDrainBytes
+	}
+
+	keepAlive := r.KeepAlive() && !s.Closed &&
+		(s.MaxRequestsPerConn == 0 || n < s.MaxRequestsPerConn)
+	if !keepAlive {
+		w.Headers.Set("Connection", "close")
+	} else if w.HttpVersion == "HTTP/1.0" {
+		w.Headers.Set("Connection", "keep-alive")
 	}
 
 	writer := bytes.NewBuffer([]byte{})
 	handlerBody := s.Handler(w, r)
+	if r.MultipartForm != nil {
+		r.MultipartForm.RemoveAll()
+	}
+
+	// the handler didn't write anything itself, answer with what it returned
+	if !w.Written() {
+		var body []byte = nil
+		var status response.StatusCode = response.StatusOk
+		if handlerBody != nil {
+			status = handlerBody.StatusCode
+			body = []byte(handlerBody.Message)
+
+		} else {
+			status = response.StatusOk
+			body = writer.Bytes()
+		}
+		if !status.BodyAllowed() {
+			body = nil
+		}
 
-	var body []byte = nil
-	var status response.StatusCode = response.StatusOk
-	if handlerBody != nil {
-		status = handlerBody.StatusCode
-		body = []byte(handlerBody.Message)
+		headers := response.GetDefaultHeaders(len(body))
+		w.WriteStatusLine(status)
+		w.WriteHeaders(headers)
+		w.WriteBody(body)
+	}
+	if err := w.Finish(); err != nil {
+		// the client can't tell where this response ends
+		return false
+	}
 
-	} else {
-		status = response.StatusOk
-		body = writer.Bytes()
+	// a client still waiting for "100 Continue" may or may not send the body
+	// after giving up, there's no telling where the next request starts
+	if !keepAlive || w.Closing() || r.WaitingForContinue() {
+		return false
 	}
+	return r.DiscardBody(maxDrainBytes) == nil
+}
+
+// writeParseError answers a request we couldn't parse. Anything that isn't a
+// *request.ParseError is a connection problem and gets no response.
+func writeParseError(w *response.Writer, err error) {
+	var perr *request.ParseError
+	if !errors.As(err, &perr) {
+		return
+	}
+	if errors.Is(err, request.ErrUnsupportedContentEncoding) {
+		// tell the client what it could have sent instead
+		w.Headers.Set("Accept-Encoding", request.SupportedContentEncodings)
+	}
+	writeError(w, response.StatusCode(perr.StatusCode), perr.Reason)
+}
 
-	headers.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+// writeError sends a short plain text response and tells the client the
+// connection is done
+func writeError(w *response.Writer, status response.StatusCode, reason string) {
+	body := []byte(reason + "\n")
+	headers := response.GetDefaultHeaders(len(body))
+	headers.Set("Connection", "close")
 	w.WriteStatusLine(status)
 	w.WriteHeaders(headers)
-	conn.Write(body)
+	w.WriteBody(body)
 }
 
 func runServer(s *Server, listener net.Listener) {
@@ -78,8 +202,11 @@ func Serve(port uint16, handler Handler) (*Server, error) {
 		return nil, err
 	}
 	server := &Server{
-		Closed:  false,
-		Handler: handler,
+		Closed:             false,
+		Handler:            handler,
+		Limits:             request.DefaultLimits,
+		IdleTimeout:        defaultIdleTimeout,
+		MaxRequestsPerConn: defaultMaxRequests,
 	}
 	go runServer(server, listener)
 	return server, nil
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	request "github/gojogourav/http-from-scratch/Request"
+	"github/gojogourav/http-from-scratch/internals/response"
+)
+
+// testConn runs s on one end of a pipe and returns the other end, done is
+// closed once runConnection returned
+func testConn(t *testing.T, s *Server) (net.Conn, *bufio.Reader, chan struct{}) {
+	if s.Limits == (request.Limits{}) {
+		s.Limits = request.DefaultLimits
+	}
+	client, conn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		runConnection(s, conn)
+		close(done)
+	}()
+	t.Cleanup(func() { client.Close() })
+	return client, bufio.NewReader(client), done
+}
+
+// send writes raw requests without waiting for them to be read, the server
+// only reads a pipelined request after answering the one before
+func send(client net.Conn, raw string) {
+	go io.WriteString(client, raw)
+}
+
+func readResponse(t *testing.T, br *bufio.Reader, method string) *response.Response {
+	resp, err := response.ReadResponse(br, method)
+	require.NoError(t, err)
+	_, err = resp.ReadBody()
+	require.NoError(t, err)
+	return resp
+}
+
+func waitClosed(t *testing.T, br *bufio.Reader, done chan struct{}) {
+	_, err := br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("connection still open")
+	}
+}
+
+func echoPath(w *response.Writer, r *request.Request) *HandlerBody {
+	return &HandlerBody{StatusCode: response.StatusOk, Message: r.URL.Path}
+}
+
+func TestKeepAlive(t *testing.T) {
+	// Test: Two requests on one connection, the second one closes it
+	client, br, done := testConn(t, &Server{Handler: echoPath})
+	send(client, "GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	resp := readResponse(t, br, "GET")
+	assert.Equal(t, "/one", string(resp.Body))
+	assert.False(t, resp.Headers.Has("Connection"))
+	assert.True(t, resp.KeepAlive())
+
+	send(client, "GET /two HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	resp = readResponse(t, br, "GET")
+	assert.Equal(t, "/two", string(resp.Body))
+	assert.Equal(t, "close", resp.Headers.Get("Connection"))
+	waitClosed(t, br, done)
+
+	// Test: HTTP/1.0 is told the connection stays open
+	client, br, _ = testConn(t, &Server{Handler: echoPath})
+	send(client, "GET /old HTTP/1.0\r\nConnection: keep-alive\r\n\r\n")
+	resp = readResponse(t, br, "GET")
+	assert.Equal(t, "keep-alive", resp.Headers.Get("Connection"))
+
+	// Test: HEAD gets the length without the body, the next response
+	// starts right after the headers
+	client, br, _ = testConn(t, &Server{Handler: echoPath})
+	send(client, "HEAD /head HTTP/1.1\r\nHost: localhost\r\n\r\nGET /next HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	resp = readResponse(t, br, "HEAD")
+	assert.Equal(t, "5", resp.Headers.Get("Content-Length"))
+	resp = readResponse(t, br, "GET")
+	assert.Equal(t, "/next", string(resp.Body))
+
+	// Test: Same for a handler that answers HEAD without writing the body
+	headOnly := func(w *response.Writer, r *request.Request) *HandlerBody {
+		if r.RequestLine.Method != "HEAD" {
+			return echoPath(w, r)
+		}
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(response.GetDefaultHeaders(5000))
+		return nil
+	}
+	client, br, _ = testConn(t, &Server{Handler: headOnly})
+	send(client, "HEAD /head HTTP/1.1\r\nHost: localhost\r\n\r\nGET /after HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	resp = readResponse(t, br, "HEAD")
+	assert.Equal(t, "5000", resp.Headers.Get("Content-Length"))
+	assert.False(t, resp.Headers.Has("Connection"))
+	resp = readResponse(t, br, "GET")
+	assert.Equal(t, "/after", string(resp.Body))
+}
+
+func TestMaxRequestsPerConn(t *testing.T) {
+	client, br, done := testConn(t, &Server{Handler: echoPath, MaxRequestsPerConn: 2})
+	send(client, strings.Repeat("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", 3))
+	resp := readResponse(t, br, "GET")
+	assert.False(t, resp.Headers.Has("Connection"))
+	resp = readResponse(t, br, "GET")
+	assert.Equal(t, "close", resp.Headers.Get("Connection"))
+	waitClosed(t, br, done)
+}
+
+func TestUnreadBody(t *testing.T) {
+	// Test: A body the handler ignored is skipped to get to the next request
+	client, br, _ := testConn(t, &Server{Handler: echoPath})
+	send(client, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 11\r\n\r\nhello world"+
+		"GET /after HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	resp := readResponse(t, br, "POST")
+	assert.Equal(t, "/upload", string(resp.Body))
+	resp = readResponse(t, br, "GET")
+	assert.Equal(t, "/after", string(resp.Body))
+
+	// Test: So is a chunked one
+	client, br, _ = testConn(t, &Server{Handler: echoPath})
+	send(client, "POST /upload HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"+
+		"GET /after HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	readResponse(t, br, "POST")
+	resp = readResponse(t, br, "GET")
+	assert.Equal(t, "/after", string(resp.Body))
+
+	// Test: Past maxDrainBytes the connection is closed instead
+	client, br, done := testConn(t, &Server{Handler: echoPath})
+	send(client, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 300000\r\n\r\n"+
+		strings.Repeat("x", 300000))
+	resp = readResponse(t, br, "POST")
+	assert.Equal(t, "close", resp.Headers.Get("Connection"))
+	waitClosed(t, br, done)
+
+	// Test: A client waiting for "100 Continue" that never comes is told
+	// the connection ends
+	client, br, done = testConn(t, &Server{Handler: echoPath})
+	send(client, "PUT /big HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	resp = readResponse(t, br, "PUT")
+	assert.Equal(t, 200, int(resp.StatusCode))
+	assert.Equal(t, "close", resp.Headers.Get("Connection"))
+	waitClosed(t, br, done)
+
+	// Test: One whose body was read keeps the connection
+	readBody := func(w *response.Writer, r *request.Request) *HandlerBody {
+		body, _ := r.ReadBody()
+		return &HandlerBody{StatusCode: response.StatusOk, Message: string(body)}
+	}
+	client, br, _ = testConn(t, &Server{Handler: readBody})
+	send(client, "PUT /big HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, _ = br.ReadString('\n')
+	assert.Equal(t, "\r\n", line)
+	send(client, "hello")
+	resp = readResponse(t, br, "PUT")
+	assert.Equal(t, "hello", string(resp.Body))
+	assert.False(t, resp.Headers.Has("Connection"))
+}
+
+func TestIdleTimeout(t *testing.T) {
+	// Test: A connection with no request in time is closed without a word
+	client, br, done := testConn(t, &Server{Handler: echoPath, IdleTimeout: 50 * time.Millisecond})
+	send(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	readResponse(t, br, "GET")
+	start := time.Now()
+	waitClosed(t, br, done)
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	// Test: So is one that stops halfway through the headers
+	client, br, done = testConn(t, &Server{Handler: echoPath, IdleTimeout: 50 * time.Millisecond})
+	send(client, "GET / HTTP/1.1\r\nHost: loc")
+	waitClosed(t, br, done)
+}
+
+func TestAbortedResponse(t *testing.T) {
+	// Test: The connection closes without the last chunk
+	abort := func(w *response.Writer, r *request.Request) *HandlerBody {
+		body, _ := w.ChunkedBody(nil)
+		io.WriteString(body, "half")
+		w.Abort()
+		return &HandlerBody{StatusCode: response.StatusInternalServerError, Message: "too late"}
+	}
+	client, br, done := testConn(t, &Server{Handler: abort})
+	send(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	resp, err := response.ReadResponse(br, "GET")
+	require.NoError(t, err)
+	_, err = resp.ReadBody()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("connection still open")
+	}
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
+	headers "github/gojogourav/http-from-scratch/Headers"
 	request "github/gojogourav/http-from-scratch/Request"
 	server "github/gojogourav/http-from-scratch/internals"
+	"github/gojogourav/http-from-scratch/internals/client"
 	"github/gojogourav/http-from-scratch/internals/response"
 )
 
@@ -16,10 +19,10 @@ const port = 42069
 
 func main() {
 	s, err := server.Serve(port, func(w *response.Writer, req *request.Request) *server.HandlerBody {
-		headers := response.GetDefaultHeaders(0)
-		headers.Set("Content-Type", "text/html")
+		h := headers.NewHeaders()
+		h.Set("Content-Type", "text/html")
 
-		path := req.RequestLine.RequestTarget
+		path := req.URL.Path
 
 		// ✅ Use if / else if instead of switch
 		switch path {
@@ -33,9 +36,8 @@ func main() {
   </body>
 </html>`)
 
-			headers.Set("Content-Length", fmt.Sprintf("%d", len(body)))
 			w.WriteStatusLine(response.StatusBadRequest)
-			w.WriteHeaders(headers)
+			w.WriteHeaders(h)
 			w.WriteBody(body)
 
 			return &server.HandlerBody{
@@ -53,9 +55,8 @@ func main() {
   </body>
 </html>`)
 
-			headers.Set("Content-Length", fmt.Sprintf("%d", len(body)))
 			w.WriteStatusLine(response.StatusInternalServerError)
-			w.WriteHeaders(headers)
+			w.WriteHeaders(h)
 			w.WriteBody(body)
 
 			return &server.HandlerBody{
@@ -66,12 +67,7 @@ func main() {
 		case "/chunked":
 			log.Println("Proxying httpbin stream...")
 
-			if _, err := fmt.Fprint(w, "HTTP/1.1 200 OK\r\n"); err != nil {
-				log.Println("Error writing status line:", err)
-				return &server.HandlerBody{StatusCode: response.StatusInternalServerError}
-			}
-
-			if err := response.ProxyHTTPinStream(w, 10); err != nil {
+			if err := client.ProxyHTTPinStream(w, 10); err != nil {
 				log.Println("Error proxying httpbin stream:", err)
 				return &server.HandlerBody{
 					StatusCode: response.StatusInternalServerError,
@@ -83,6 +79,41 @@ func main() {
 				StatusCode: response.StatusOk,
 				Message:    "Chunked httpbin stream sent",
 			}
+		case "/events":
+			// a tick a second, a reconnecting client picks up after the last
+			// one it saw
+			next := 1
+			if id, err := strconv.Atoi(req.Headers.Get("Last-Event-ID")); err == nil {
+				next = id + 1
+			}
+			stream, err := w.EventStream(req.Headers.Get("Last-Event-ID"))
+			if err != nil {
+				log.Println("Error starting event stream:", err)
+				return nil
+			}
+			defer stream.Close()
+			stream.Heartbeat(15 * time.Second)
+
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for ; next <= 10; next++ {
+				select {
+				case <-ticker.C:
+				case <-stream.Done():
+					log.Println("Event stream client went away")
+					return nil
+				}
+				err := stream.Send(response.Event{
+					Event: "tick",
+					ID:    strconv.Itoa(next),
+					Data:  time.Now().Format(time.RFC3339),
+				})
+				if err != nil {
+					return nil
+				}
+			}
+			return nil
+
 		case "/video":
 			f, err := os.ReadFile("assets/vim.mp4")
 			if err != nil {
@@ -93,13 +124,12 @@ func main() {
 				}
 			}
 
-			headers.Delete("Content-Type") // remove text/plain
-			headers.Set("Content-Type", "video/mp4")
-			headers.Set("Content-Length", fmt.Sprintf("%d", len(f)))
-			headers.Set("Connection", "close")
+			h.Set("Content-Type", "video/mp4")
+			h.SetContentLength(int64(len(f)))
+			h.Set("Connection", "close")
 
 			w.WriteStatusLine(response.StatusOk)
-			w.WriteHeaders(headers)
+			w.WriteHeaders(h)
 
 			w.WriteBody(f)
 
@@ -117,9 +147,8 @@ func main() {
     <p>Your request was an absolute banger.</p>
   </body>
 </html>`)
-			headers.Set("Content-Length", fmt.Sprintf("%d", len(body)))
 			w.WriteStatusLine(response.StatusOk)
-			w.WriteHeaders(headers)
+			w.WriteHeaders(h)
 			w.WriteBody(body)
 			return &server.HandlerBody{
 				StatusCode: response.StatusOk,